@@ -0,0 +1,302 @@
+// Package asm translates a readable assembly text into core VM bytecode.
+//
+// Each line holds an optional label, an optional instruction and an
+// optional comment starting with ';':
+//
+//	loop:   pushint 1       ; operand is placed before the opcode
+//	        jumpif loop
+//	        str "foo"       ; strcreate 3, pushbyte 'f', 'o', 'o', strpack
+//
+// Integer operands are decimal or 0x prefixed hex numbers, characters are
+// quoted with single quotes. Jump targets are labels or offsets.
+package asm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/igumus/chainx/core"
+)
+
+var (
+	ErrUnknownMnemonic  = errors.New("unknown mnemonic")
+	ErrOperandCount     = errors.New("wrong number of operands")
+	ErrOperandNotValid  = errors.New("operand is invalid")
+	ErrLabelNotValid    = errors.New("label is invalid")
+	ErrLabelDuplicate   = errors.New("label is already defined")
+	ErrLabelUnknown     = errors.New("label is not defined")
+	ErrLabelNoTarget    = errors.New("label is not followed by an instruction")
+	ErrLiteralNotClosed = errors.New("literal is not closed")
+)
+
+// LineError reports an error found at a line of the assembly text.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// pseudo instruction assembling a packed string
+const strMnemonic = "str"
+
+// mnemonics maps assembly mnemonics to VM instructions.
+var mnemonics = map[string]core.Instruction{
+	"pushint":      core.InstrPushInt,
+	"pushbyte":     core.InstrPushByte,
+	"strcreate":    core.InstrStrCreate,
+	"strpack":      core.InstrStrPack,
+	"store":        core.InstrStore,
+	"loadstate":    core.InstrLoadState,
+	"mul":          core.InstrMultiply,
+	"sub":          core.InstrSub,
+	"add":          core.InstrAdd,
+	"log":          core.InstrLog,
+	"loadrange":    core.InstrLoadRange,
+	"loadexternal": core.InstrLoadExternal,
+	"eq":           core.InstrEq,
+	"lt":           core.InstrLt,
+	"gt":           core.InstrGt,
+	"and":          core.InstrAnd,
+	"or":           core.InstrOr,
+	"not":          core.InstrNot,
+	"jump":         core.InstrJump,
+	"jumpif":       core.InstrJumpIf,
+	"halt":         core.InstrHalt,
+}
+
+// statement is an instruction of the assembly text.
+type statement struct {
+	line     int
+	mnemonic string
+	operands []string
+}
+
+// Assemble translates given assembly text into VM bytecode.
+func Assemble(src string) ([]byte, error) {
+	// first pass sizes statements and resolves label offsets, second
+	// pass emits bytecode
+	statements := []*statement{}
+	labels := make(map[string]int)
+	offset := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for line := 1; scanner.Scan(); line++ {
+		tokens, err := tokenize(scanner.Text())
+		if err != nil {
+			return nil, &LineError{Line: line, Err: err}
+		}
+		if len(tokens) > 0 && strings.HasSuffix(tokens[0], ":") {
+			label := strings.TrimSuffix(tokens[0], ":")
+			if !validLabel(label) {
+				return nil, &LineError{Line: line, Err: ErrLabelNotValid}
+			}
+			if _, ok := labels[label]; ok {
+				return nil, &LineError{Line: line, Err: ErrLabelDuplicate}
+			}
+			labels[label] = offset
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		stmt := &statement{
+			line:     line,
+			mnemonic: strings.ToLower(tokens[0]),
+			operands: tokens[1:],
+		}
+		size, err := stmt.size()
+		if err != nil {
+			return nil, &LineError{Line: line, Err: err}
+		}
+		statements = append(statements, stmt)
+		offset += size
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	code := make([]byte, 0, offset)
+	for _, stmt := range statements {
+		b, err := stmt.emit(labels, offset)
+		if err != nil {
+			return nil, &LineError{Line: stmt.line, Err: err}
+		}
+		code = append(code, b...)
+	}
+	return code, nil
+}
+
+// size returns number of bytecode bytes of the statement.
+func (s *statement) size() (int, error) {
+	if s.mnemonic == strMnemonic {
+		str, err := s.str()
+		if err != nil {
+			return 0, err
+		}
+		return 2 + 2*len(str) + 1, nil
+	}
+	instr, ok := mnemonics[s.mnemonic]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownMnemonic, s.mnemonic)
+	}
+	expected := 0
+	if instr.Operands() > 0 {
+		expected = 1
+	}
+	if len(s.operands) != expected {
+		return 0, ErrOperandCount
+	}
+	return instr.Operands() + 1, nil
+}
+
+// emit returns bytecode of the statement, labels are resolved to offsets
+// within bytecode of given size.
+func (s *statement) emit(labels map[string]int, size int) ([]byte, error) {
+	if s.mnemonic == strMnemonic {
+		str, err := s.str()
+		if err != nil {
+			return nil, err
+		}
+		code := []byte{byte(len(str)), byte(core.InstrStrCreate)}
+		for _, c := range []byte(str) {
+			code = append(code, c, byte(core.InstrPushByte))
+		}
+		return append(code, byte(core.InstrStrPack)), nil
+	}
+
+	instr := mnemonics[s.mnemonic]
+	switch instr.Operands() {
+	case 0:
+		return []byte{byte(instr)}, nil
+	case 1:
+		v, err := parseInt(s.operands[0], math.MaxUint8)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{byte(v), byte(instr)}, nil
+	default:
+		target, err := jumpTarget(s.operands[0], labels, size)
+		if err != nil {
+			return nil, err
+		}
+		code := binary.LittleEndian.AppendUint16(nil, target)
+		return append(code, byte(instr)), nil
+	}
+}
+
+// str returns the string literal operand of a str statement.
+func (s *statement) str() (string, error) {
+	if len(s.operands) != 1 {
+		return "", ErrOperandCount
+	}
+	if !strings.HasPrefix(s.operands[0], `"`) {
+		return "", fmt.Errorf("%w: %s", ErrOperandNotValid, s.operands[0])
+	}
+	str, err := strconv.Unquote(s.operands[0])
+	if err != nil || len(str) > math.MaxUint8 {
+		return "", fmt.Errorf("%w: %s", ErrOperandNotValid, s.operands[0])
+	}
+	return str, nil
+}
+
+func jumpTarget(operand string, labels map[string]int, size int) (uint16, error) {
+	if validLabel(operand) {
+		offset, ok := labels[operand]
+		if !ok {
+			return 0, fmt.Errorf("%w: %s", ErrLabelUnknown, operand)
+		}
+		// a label after the last instruction is not a valid jump target
+		if offset >= size {
+			return 0, fmt.Errorf("%w: %s", ErrLabelNoTarget, operand)
+		}
+		if offset > math.MaxUint16 {
+			return 0, fmt.Errorf("%w: %s", ErrOperandNotValid, operand)
+		}
+		return uint16(offset), nil
+	}
+	v, err := parseInt(operand, math.MaxUint16)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(v), nil
+}
+
+// parseInt parses an integer or character literal not greater than max.
+func parseInt(operand string, max uint64) (uint64, error) {
+	if strings.HasPrefix(operand, "'") {
+		c, err := strconv.Unquote(operand)
+		if err != nil || len(c) != 1 {
+			return 0, fmt.Errorf("%w: %s", ErrOperandNotValid, operand)
+		}
+		return uint64(c[0]), nil
+	}
+	v, err := strconv.ParseUint(operand, 0, 64)
+	if err != nil || v > max {
+		return 0, fmt.Errorf("%w: %s", ErrOperandNotValid, operand)
+	}
+	return v, nil
+}
+
+func validLabel(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// tokenize splits a line into whitespace or comma separated tokens,
+// keeping quoted literals together and dropping comments.
+func tokenize(line string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == ',':
+			i++
+		case c == ';':
+			return tokens, nil
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, ErrLiteralNotClosed
+			}
+			tokens = append(tokens, line[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(line) && !strings.ContainsRune(" \t,;", rune(line[end])) {
+				end++
+			}
+			tokens = append(tokens, line[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
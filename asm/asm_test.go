@@ -0,0 +1,94 @@
+package asm
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/igumus/chainx/core"
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssemble(t *testing.T) {
+	code, err := Assemble(`
+		; stores 1 + 2 under "foo"
+		str "foo"
+		pushint 1
+		pushint 0x02
+		add
+		store
+	`)
+	require.Nil(t, err)
+	require.Equal(t, []byte{
+		0x03, byte(core.InstrStrCreate),
+		'f', byte(core.InstrPushByte),
+		'o', byte(core.InstrPushByte),
+		'o', byte(core.InstrPushByte),
+		byte(core.InstrStrPack),
+		0x01, byte(core.InstrPushInt),
+		0x02, byte(core.InstrPushInt),
+		byte(core.InstrAdd),
+		byte(core.InstrStore),
+	}, code)
+
+	state := core.NewState()
+	require.Nil(t, core.NewVM(code, crypto.Address{}, state).Run())
+	v, err := state.Get(core.ContractKey(crypto.Address{}, []byte("foo")))
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), binary.LittleEndian.Uint64(v))
+}
+
+func TestAssembleLabels(t *testing.T) {
+	code, err := Assemble(`
+		pushint 1
+		jumpif done    ; forward reference
+		pushint 'a'
+		log
+	done:	halt
+	`)
+	require.Nil(t, err)
+	require.Equal(t, []byte{
+		0x01, byte(core.InstrPushInt),
+		0x08, 0x00, byte(core.InstrJumpIf),
+		'a', byte(core.InstrPushInt),
+		byte(core.InstrLog),
+		byte(core.InstrHalt),
+	}, code)
+
+	vm := core.NewVM(code, crypto.Address{}, core.NewState())
+	require.Nil(t, vm.Run())
+	require.Empty(t, vm.Logs())
+}
+
+func TestAssembleErrors(t *testing.T) {
+	testcases := []struct {
+		name string
+		src  string
+		line int
+		err  error
+	}{
+		{name: "mnemonic", src: "add\nfoo", line: 2, err: ErrUnknownMnemonic},
+		{name: "missing-operand", src: "pushint", line: 1, err: ErrOperandCount},
+		{name: "extra-operand", src: "add 1", line: 1, err: ErrOperandCount},
+		{name: "operand-range", src: "\n\npushint 256", line: 3, err: ErrOperandNotValid},
+		{name: "char", src: "pushbyte 'ab'", line: 1, err: ErrOperandNotValid},
+		{name: "string", src: `str foo`, line: 1, err: ErrOperandNotValid},
+		{name: "literal", src: `str "foo`, line: 1, err: ErrLiteralNotClosed},
+		{name: "unknown-label", src: "halt\njump end", line: 2, err: ErrLabelUnknown},
+		{name: "duplicate-label", src: "a: halt\na: halt", line: 2, err: ErrLabelDuplicate},
+		{name: "invalid-label", src: "1a: halt", line: 1, err: ErrLabelNotValid},
+		{name: "trailing-label", src: "jump end\nhalt\nend:", line: 1, err: ErrLabelNoTarget},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Assemble(tc.src)
+			require.ErrorIs(t, err, tc.err)
+
+			var lineErr *LineError
+			require.True(t, errors.As(err, &lineErr))
+			require.Equal(t, tc.line, lineErr.Line)
+		})
+	}
+}
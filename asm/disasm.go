@@ -0,0 +1,88 @@
+package asm
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/igumus/chainx/core"
+)
+
+// Instruction is an instruction decoded from VM bytecode.
+type Instruction struct {
+	Offset  int    // offset of the first byte, operands come first
+	Bytes   []byte // operands followed by the opcode
+	Opcode  core.Instruction
+	Operand []byte
+	Known   bool // opcode is a VM instruction
+}
+
+// Disassemble decodes VM bytecode into instructions. Like the VM, it
+// decodes backwards from the last byte; leading bytes which can not be
+// operands of the first instruction are returned as unknown
+// instructions.
+func Disassemble(code []byte) []*Instruction {
+	instrs := []*Instruction{}
+	for i := len(code) - 1; i >= 0; {
+		op := core.Instruction(code[i])
+		start := i - op.Operands()
+		if start < 0 {
+			start = i
+		}
+		_, known := names[op]
+		instrs = append(instrs, &Instruction{
+			Offset:  start,
+			Bytes:   code[start : i+1],
+			Opcode:  op,
+			Operand: code[start:i],
+			Known:   known && len(code[start:i]) == op.Operands(),
+		})
+		i = start - 1
+	}
+	for i, j := 0, len(instrs)-1; i < j; i, j = i+1, j-1 {
+		instrs[i], instrs[j] = instrs[j], instrs[i]
+	}
+	return instrs
+}
+
+// names maps VM instructions to their mnemonics.
+var names = func() map[core.Instruction]string {
+	result := make(map[core.Instruction]string, len(mnemonics))
+	for name, instr := range mnemonics {
+		result[instr] = name
+	}
+	return result
+}()
+
+// String renders the instruction in assembly syntax, which assembles back
+// to the same bytes for known instructions.
+func (i *Instruction) String() string {
+	if !i.Known {
+		return fmt.Sprintf("unknown 0x%02x", byte(i.Opcode))
+	}
+	name := names[i.Opcode]
+	switch len(i.Operand) {
+	case 0:
+		return name
+	case 1:
+		v := i.Operand[0]
+		if i.Opcode == core.InstrPushByte && strconv.IsPrint(rune(v)) && v < 0x80 {
+			return fmt.Sprintf("%s %s", name, strconv.QuoteRune(rune(v)))
+		}
+		return fmt.Sprintf("%s %d", name, v)
+	default:
+		return fmt.Sprintf("%s %d", name, binary.LittleEndian.Uint16(i.Operand))
+	}
+}
+
+// Format renders bytecode as a listing of instruction offsets, bytes and
+// assembly.
+func Format(code []byte) string {
+	var sb strings.Builder
+	for _, instr := range Disassemble(code) {
+		fmt.Fprintf(&sb, "%04x  %-10s %s\n", instr.Offset, hex.EncodeToString(instr.Bytes), instr)
+	}
+	return sb.String()
+}
@@ -0,0 +1,50 @@
+package asm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/igumus/chainx/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisassemble(t *testing.T) {
+	src := `
+	loop:	str "a"
+		pushint 7
+		store
+		pushint 0
+		jumpif loop
+		halt
+	`
+	code, err := Assemble(src)
+	require.Nil(t, err)
+
+	instrs := Disassemble(code)
+	lines := []string{}
+	for _, instr := range instrs {
+		require.True(t, instr.Known)
+		lines = append(lines, instr.String())
+	}
+	require.Equal(t, []string{
+		"strcreate 1", "pushbyte 'a'", "strpack",
+		"pushint 7", "store", "pushint 0", "jumpif 0", "halt",
+	}, lines)
+	require.Equal(t, 10, instrs[6].Offset)
+	require.Equal(t, []byte{0x00, 0x00}, instrs[6].Operand)
+
+	// listing renders back to the same bytecode
+	reassembled, err := Assemble(strings.Join(lines, "\n"))
+	require.Nil(t, err)
+	require.Equal(t, code, reassembled)
+	require.True(t, strings.HasPrefix(Format(code), "0000  010c       strcreate 1\n"))
+}
+
+func TestDisassembleUnknown(t *testing.T) {
+	// leading push lacks its operand, 0x01 is not an instruction
+	instrs := Disassemble([]byte{byte(core.InstrPushInt), 0x01, byte(core.InstrAdd)})
+	require.Len(t, instrs, 3)
+	require.Equal(t, "unknown 0x0a", instrs[0].String())
+	require.Equal(t, "unknown 0x01", instrs[1].String())
+	require.Equal(t, "add", instrs[2].String())
+}
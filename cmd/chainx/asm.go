@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/igumus/chainx/asm"
+)
+
+func runAsm(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	output := fs.String("o", "", "path of bytecode output file, hex encoded bytecode printed if empty")
+	fs.Parse(args)
+
+	src, err := readInput(fs)
+	if err != nil {
+		return err
+	}
+	code, err := asm.Assemble(string(src))
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, code)
+}
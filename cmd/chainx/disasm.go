@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/igumus/chainx/asm"
+	"github.com/igumus/chainx/core"
+	"github.com/igumus/chainx/hash"
+)
+
+var errTxNotFound = errors.New("transaction not found")
+
+func runDisasm(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	raw := fs.Bool("raw", false, "input file holds raw bytecode instead of hex encoded bytecode")
+	dataDir := fs.String("data-dir", "", "directory of block storage to read the transaction from")
+	genesisFile := fs.String("genesis", "", "path of genesis spec file of the chain, default genesis used if empty")
+	blockHash := fs.String("block", "", "hash of the block holding the transaction, every block searched if empty")
+	txHash := fs.String("tx", "", "hash of the transaction to disassemble")
+	fs.Parse(args)
+
+	var code []byte
+	if len(*txHash) > 0 {
+		tx, err := findTransaction(*dataDir, *genesisFile, *blockHash, *txHash)
+		if err != nil {
+			return err
+		}
+		code = tx.Data
+	} else {
+		input, err := readInput(fs)
+		if err != nil {
+			return err
+		}
+		code = input
+		if !*raw {
+			if code, err = hex.DecodeString(strings.TrimSpace(string(input))); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Print(asm.Format(code))
+	return nil
+}
+
+// findTransaction reads the transaction with given hash from the block
+// storage in given directory.
+func findTransaction(dataDir, genesisFile, blockHash, txHash string) (*core.Transaction, error) {
+	// transaction hashes depend on the hash algorithm of the chain
+	if len(genesisFile) > 0 {
+		genesis, err := core.LoadGenesis(genesisFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := hash.SetDefaultAlgorithm(genesis.HashAlgorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	h, err := hash.FromHexString(txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := core.NewReadOnlyFileStorage(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	defer storage.Close()
+
+	blocks := []*core.Block{}
+	if len(blockHash) > 0 {
+		bh, err := hash.FromHexString(blockHash)
+		if err != nil {
+			return nil, err
+		}
+		b, err := storage.GetByHash(bh)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	} else if storage.Size() > 0 {
+		if blocks, err = storage.GetAll(0, uint32(storage.Size()-1)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			if tx.Hash().IsEqual(h) {
+				return tx, nil
+			}
+		}
+	}
+	return nil, errTxNotFound
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand of the chainx tool.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []*command{
+	{name: "asm", usage: "assemble VM bytecode from assembly text", run: runAsm},
+	{name: "disasm", usage: "disassemble VM bytecode of a file or a stored transaction", run: runDisasm},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: chainx <command> [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "chainx %s: %s\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
+}
+
+// readInput reads the file given as the only argument of the flag set,
+// or stdin if no file is given.
+func readInput(fs *flag.FlagSet) ([]byte, error) {
+	switch fs.NArg() {
+	case 0:
+		return io.ReadAll(os.Stdin)
+	case 1:
+		return os.ReadFile(fs.Arg(0))
+	default:
+		fs.Usage()
+		return nil, fmt.Errorf("expected a single input file")
+	}
+}
+
+// writeOutput writes data to given file, or hex encoded to stdout if no
+// file is given.
+func writeOutput(path string, data []byte) error {
+	if len(path) == 0 {
+		_, err := fmt.Println(hex.EncodeToString(data))
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
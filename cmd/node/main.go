@@ -1,14 +1,15 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/igumus/chainx/asm"
 	"github.com/igumus/chainx/core"
 	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
 	"github.com/igumus/chainx/network"
 	"github.com/igumus/chainx/node"
 
@@ -27,6 +28,10 @@ func main() {
 	seq := flag.String("seq", "1", "sequence number of node")
 	//tcpAddr := flag.String("net-addr", ":3001", "listen address of the grpc transport")
 	bootstrapnode := flag.String("node", ":3000", "seed node listen addr")
+	dataDir := flag.String("data-dir", "", "directory of persistent block storage, in-memory storage used if empty")
+	genesisFile := flag.String("genesis", "", "path of genesis spec file, default genesis used if empty")
+	codecs := flag.String("codecs", "", "comma separated codec names (gob, json, canonical) in preference order, every codec supported if empty")
+	keyFile := flag.String("key-file", "", "path of hex encoded private key, created if missing, random key used if empty")
 	flag.Parse()
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -36,28 +41,45 @@ func main() {
 	}
 
 	// creating cryptographic keypair
-	key, err := crypto.GenerateKeyPair()
+	key, err := crypto.LoadOrCreateKeyPair(*keyFile)
 	panicErr(err)
 
+	// loading genesis spec
+	genesis := core.DefaultGenesis()
+	if len(*genesisFile) > 0 {
+		genesis, err = core.LoadGenesis(*genesisFile)
+		panicErr(err)
+	}
+	panicErr(hash.SetDefaultAlgorithm(genesis.HashAlgorithm))
+
 	name := fmt.Sprintf("NODE_%s", *seq)
 	addr := fmt.Sprintf(":300%s", *seq)
 
+	// creating block storage
+	storage := core.NewMemoryStorage()
+	if len(*dataDir) > 0 {
+		storage, err = core.NewFileStorage(*dataDir)
+		panicErr(err)
+	}
+
+	// creating blockchain instance
+	bc, err := core.NewBlockChain(core.WithGenesis(genesis), core.WithStorage(storage))
+	panicErr(err)
+
 	// creating chain network
 	network, err := network.New(
 		network.WithDebugMode(*debug),
 		network.WithName(name),
 		network.WithKeyPair(key),
+		network.WithGenesisHash(bc.GenesisHash()),
+		network.WithCodecs(strings.Split(*codecs, ",")...),
 		network.WithTCPTransport(addr),
 		network.WithSeedNode(*bootstrapnode),
 	)
 	panicErr(err)
 
-	// creating blockchain instance
-	bc, err := core.NewBlockChain()
-	panicErr(err)
-
 	// creating txpool instance
-	txpool, err := core.NewTXPool()
+	txpool, err := core.NewTXPool(core.WithChainReader(bc))
 	panicErr(err)
 
 	// creating node instance
@@ -75,8 +97,17 @@ func main() {
 
 	txTicker := time.NewTicker(1 * time.Second)
 	go func() {
+		// nonce continues after the transactions of the key executed so
+		// far, and only advances when a transaction is accepted
+		account, err := bc.GetAccount(key.Address())
+		panicErr(err)
+		nonce := account.Nonce
 		for {
-			sendTransaction(key, network)
+			if err := sendTransaction(key, server, bc.ChainID(), nonce); err != nil {
+				log.Error().Err(err).Uint64("nonce", nonce).Msg("sending transaction failed")
+			} else {
+				nonce++
+			}
 			<-txTicker.C
 		}
 	}()
@@ -84,49 +115,39 @@ func main() {
 	select {}
 }
 
-func sendTransaction(k *crypto.KeyPair, n network.Network) {
-	data := []byte{
-		0x03,
-		byte(core.InstrStrCreate),
-		0x66,
-		byte(core.InstrPushByte),
-		0x6f,
-		byte(core.InstrPushByte),
-		0x6f,
-		byte(core.InstrPushByte),
-		byte(core.InstrStrPack),
-		0x01,
-		byte(core.InstrPushInt),
-		0x02,
-		byte(core.InstrPushInt),
-		byte(core.InstrAdd),
-		byte(core.InstrStore),
+// sendTransaction hands a demo transaction to the node as if it came
+// from a peer, returning the error of adding it to the pool.
+func sendTransaction(k *crypto.KeyPair, h network.RemoteMessageHandler, chainID uint32, nonce uint64) error {
+	data, err := asm.Assemble(`
+		str "foo"
+		pushint 1
+		pushint 2
+		add
+		store
+	`)
+	if err != nil {
+		return err
 	}
 	tx := core.NewTransaction(data)
-	tx.Sign(k)
-
-	buf := new(bytes.Buffer)
-	if err := core.EncodeTransaction(buf, tx); err != nil {
-		log.Error().Err(err)
-		return
+	tx.ChainID = chainID
+	tx.Nonce = nonce
+	if err := tx.Sign(k); err != nil {
+		return err
 	}
 
-	message := &network.Message{
-		Header: network.ChainTx,
-		Data:   buf.Bytes(),
+	message, err := network.NewMessage(network.ChainTx, tx, core.DefaultCodec)
+	if err != nil {
+		return err
 	}
 
 	mbuf, err := message.Bytes()
 	if err != nil {
-		log.Error().Err(err)
-		return
+		return err
 	}
 
 	remote := network.RemoteMessage{
 		From:    network.PeerID(k.Address().String()),
 		Payload: mbuf,
 	}
-	if err := n.HandleMessage(remote); err != nil {
-		log.Error().Err(err)
-	}
+	return h.HandleMessage(remote)
 }
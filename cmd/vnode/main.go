@@ -2,9 +2,11 @@ package main
 
 import (
 	"flag"
+	"strings"
 
 	"github.com/igumus/chainx/core"
 	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
 	"github.com/igumus/chainx/network"
 	"github.com/igumus/chainx/node"
 	"github.com/rs/zerolog"
@@ -21,6 +23,10 @@ func main() {
 	debug := flag.Bool("debug", false, "debug mode")
 	name := flag.String("name", "VNODE", "name of network")
 	tcpAddr := flag.String("net-addr", ":3000", "listen address of the tcp transport")
+	dataDir := flag.String("data-dir", "", "directory of persistent block storage, in-memory storage used if empty")
+	genesisFile := flag.String("genesis", "", "path of genesis spec file, default genesis used if empty")
+	codecs := flag.String("codecs", "", "comma separated codec names (gob, json, canonical) in preference order, every codec supported if empty")
+	keyFile := flag.String("key-file", "", "path of hex encoded private key, created if missing, random key used if empty")
 	flag.Parse()
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -30,24 +36,41 @@ func main() {
 	}
 
 	// creating cryptographic keypair
-	key, err := crypto.GenerateKeyPair()
+	key, err := crypto.LoadOrCreateKeyPair(*keyFile)
+	panicErr(err)
+
+	// loading genesis spec
+	genesis := core.DefaultGenesis()
+	if len(*genesisFile) > 0 {
+		genesis, err = core.LoadGenesis(*genesisFile)
+		panicErr(err)
+	}
+	panicErr(hash.SetDefaultAlgorithm(genesis.HashAlgorithm))
+
+	// creating block storage
+	storage := core.NewMemoryStorage()
+	if len(*dataDir) > 0 {
+		storage, err = core.NewFileStorage(*dataDir)
+		panicErr(err)
+	}
+
+	// creating blockchain instance
+	bc, err := core.NewBlockChain(core.WithGenesis(genesis), core.WithStorage(storage))
 	panicErr(err)
 
 	// creating chain network
 	network, err := network.New(
 		network.WithKeyPair(key),
+		network.WithGenesisHash(bc.GenesisHash()),
+		network.WithCodecs(strings.Split(*codecs, ",")...),
 		network.WithTCPTransport(*tcpAddr),
 		network.WithName(*name),
 		network.WithDebugMode(*debug),
 	)
 	panicErr(err)
 
-	// creating blockchain instance
-	bc, err := core.NewBlockChain()
-	panicErr(err)
-
 	// creating txpool instance
-	txpool, err := core.NewTXPool()
+	txpool, err := core.NewTXPool(core.WithChainReader(bc))
 	panicErr(err)
 
 	// creating node instance
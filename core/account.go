@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"github.com/igumus/chainx/crypto"
+)
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient account balance")
+	ErrTxNonceNotValid     = errors.New("transaction nonce is invalid")
+	ErrTxNonceTooLow       = errors.New("transaction nonce too low")
+	ErrReservedStateKey    = errors.New("state key is reserved")
+	ErrBalanceOverflow     = errors.New("account balance overflows")
+)
+
+// keys starting with this byte are reserved for chain data (accounts,
+// chain identity), contracts are not allowed to write them
+const reservedKeyPrefix byte = 0x00
+
+// accounts are kept in contract state under this prefix
+var accountKeyPrefix = []byte("\x00account/")
+
+type Account struct {
+	Balance uint64
+	Nonce   uint64
+}
+
+// ChainReader provides read access to chain identity and account state.
+type ChainReader interface {
+	ChainID() uint32
+	GetAccount(crypto.Address) (*Account, error)
+}
+
+func accountKey(addr crypto.Address) []byte {
+	return bytes.Join([][]byte{accountKeyPrefix, addr.Bytes()}, []byte{})
+}
+
+func isReservedKey(k []byte) bool {
+	return len(k) > 0 && k[0] == reservedKeyPrefix
+}
+
+func (a *Account) bytes() []byte {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf[0:8], a.Balance)
+	binary.LittleEndian.PutUint64(buf[8:16], a.Nonce)
+	return buf
+}
+
+// credit adds given amount to the balance, unless the sum overflows.
+func (a *Account) credit(amount uint64) error {
+	balance, carry := bits.Add64(a.Balance, amount, 0)
+	if carry != 0 {
+		return ErrBalanceOverflow
+	}
+	a.Balance = balance
+	return nil
+}
+
+// GetAccount returns account of given address, accounts which are not
+// present in state are returned with zero balance and nonce.
+func (s *State) GetAccount(addr crypto.Address) *Account {
+	v, ok := s.lookup(string(accountKey(addr)))
+	if !ok || len(v) != 16 {
+		return &Account{}
+	}
+	return &Account{
+		Balance: binary.LittleEndian.Uint64(v[0:8]),
+		Nonce:   binary.LittleEndian.Uint64(v[8:16]),
+	}
+}
+
+func (s *State) PutAccount(addr crypto.Address, a *Account) error {
+	return s.Put(accountKey(addr), a.bytes())
+}
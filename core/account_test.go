@@ -0,0 +1,151 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func createSignedTransfer(t *testing.T, kp *crypto.KeyPair, to crypto.Address, value uint64, nonce uint64) *Transaction {
+	tx := NewTransferTransaction(to, value, nonce)
+	require.Nil(t, tx.Sign(kp))
+	return tx
+}
+
+func TestAccountState(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	state := NewState()
+	account := state.GetAccount(kp.Address())
+	require.Equal(t, uint64(0), account.Balance)
+	require.Equal(t, uint64(0), account.Nonce)
+
+	require.Nil(t, state.PutAccount(kp.Address(), &Account{Balance: 10, Nonce: 2}))
+	account = state.GetAccount(kp.Address())
+	require.Equal(t, uint64(10), account.Balance)
+	require.Equal(t, uint64(2), account.Nonce)
+}
+
+func TestAccountTransfer(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	receiver, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithGenesisAlloc(sender.Address(), 100))
+	require.Nil(t, err)
+
+	account, err := bc.GetAccount(sender.Address())
+	require.Nil(t, err)
+	require.Equal(t, uint64(100), account.Balance)
+
+	txs := []*Transaction{
+		createSignedTransfer(t, sender, receiver.Address(), 60, 0),
+		// exceeds remaining balance, left out of the block
+		createSignedTransfer(t, sender, receiver.Address(), 60, 1),
+	}
+	b, err := bc.CreateBlock(sender, txs)
+	require.Nil(t, err)
+	require.Len(t, b.Transactions, 1)
+
+	account, err = bc.GetAccount(sender.Address())
+	require.Nil(t, err)
+	require.Equal(t, uint64(40), account.Balance)
+	require.Equal(t, uint64(1), account.Nonce)
+
+	account, err = bc.GetAccount(receiver.Address())
+	require.Nil(t, err)
+	require.Equal(t, uint64(60), account.Balance)
+	require.Equal(t, uint64(0), account.Nonce)
+}
+
+func TestAccountCreditOverflow(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	receiver, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithGenesisAlloc(sender.Address(), 100))
+	require.Nil(t, err)
+	c := bc.(*chain)
+
+	state := c.contractState.Stage()
+	require.Nil(t, state.PutAccount(receiver.Address(), &Account{Balance: math.MaxUint64}))
+
+	// transaction wrapping the receiver balance is rejected and leaves
+	// state untouched
+	tx := createSignedTransfer(t, sender, receiver.Address(), 1, 0)
+	_, err = c.applyTransaction(tx, state, crypto.Address{})
+	require.Equal(t, ErrBalanceOverflow, err)
+	require.Equal(t, uint64(100), state.GetAccount(sender.Address()).Balance)
+	require.Equal(t, uint64(math.MaxUint64), state.GetAccount(receiver.Address()).Balance)
+
+	// so is one wrapping the producer balance with its fee
+	tx = createSignedTransfer(t, sender, crypto.Address{}, 0, 0)
+	tx.GasPrice = 1
+	require.Nil(t, tx.Sign(sender))
+	_, err = c.applyTransaction(tx, state, receiver.Address())
+	require.Equal(t, ErrBalanceOverflow, err)
+	require.Equal(t, uint64(0), state.GetAccount(sender.Address()).Nonce)
+}
+
+func TestAccountBlockValidation(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	receiver, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithGenesisAlloc(sender.Address(), 100))
+	require.Nil(t, err)
+
+	testcases := []struct {
+		name string
+		tx   *Transaction
+		err  error
+	}{
+		{
+			name: "invalid-nonce",
+			tx:   createSignedTransfer(t, sender, receiver.Address(), 10, 1),
+			err:  ErrTxNonceNotValid,
+		},
+		{
+			name: "insufficient-balance",
+			tx:   createSignedTransfer(t, sender, receiver.Address(), 101, 0),
+			err:  ErrInsufficientBalance,
+		},
+		{
+			name: "unknown-type",
+			tx: func() *Transaction {
+				tx := NewTransferTransaction(receiver.Address(), 10, 0)
+				tx.Type = 0x7
+				require.Nil(t, tx.Sign(sender))
+				return tx
+			}(),
+			err: ErrTxTypeNotValid,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewBlock(bc.CurrentHeader(), []*Transaction{tc.tx})
+			require.Nil(t, err)
+			require.Nil(t, b.Sign(sender))
+			require.Equal(t, tc.err, bc.AddBlock(b))
+		})
+	}
+}
+
+func TestAccountReservedKey(t *testing.T) {
+	key := accountKey(crypto.Address{})
+	contract := []byte{byte(len(key)), byte(InstrStrCreate)}
+	for _, c := range key {
+		contract = append(contract, c, byte(InstrPushByte))
+	}
+	contract = append(contract, byte(InstrStrPack), 0x01, byte(InstrPushInt), byte(InstrStore))
+
+	err := NewVM(contract, crypto.Address{}, NewState()).Run()
+	require.Equal(t, ErrReservedStateKey, err)
+}
@@ -1,7 +1,6 @@
 package core
 
 import (
-	"bytes"
 	"errors"
 	"time"
 
@@ -17,12 +16,16 @@ type Header struct {
 	Timestamp     int64
 	PrevBlockHash hash.Hash
 	DataHash      hash.Hash
+	StateRoot     hash.Hash
+	ReceiptsRoot  hash.Hash
+	Proposer      crypto.Address // address of the block signer
 }
 
+// Bytes returns canonical encoding of the header.
 func (h *Header) Bytes() []byte {
-	buf := &bytes.Buffer{}
-	EncodeHeader(buf, h)
-	return buf.Bytes()
+	w := &canonicalWriter{}
+	w.header(h)
+	return w.buf.Bytes()
 }
 
 func (h *Header) Hash() hash.Hash {
@@ -35,13 +38,28 @@ type Block struct {
 	Signature    *crypto.Signature
 }
 
+// Bytes returns canonical encoding of the block.
+func (b *Block) Bytes() []byte {
+	w := &canonicalWriter{}
+	w.block(b)
+	return w.buf.Bytes()
+}
+
 func GenesisBlock() (*Block, error) {
+	return DefaultGenesis().Block()
+}
+
+// NewGenesisBlock creates genesis block committing to the given initial
+// state (e.g. genesis account allocations).
+func NewGenesisBlock(state *State) (*Block, error) {
 	header := &Header{
 		Version:       1,
 		Height:        0,
 		Timestamp:     000000000,
 		PrevBlockHash: hash.ZeroHash,
 		DataHash:      hash.ZeroHash,
+		StateRoot:     state.Root(),
+		ReceiptsRoot:  hash.ZeroHash,
 	}
 
 	block := &Block{
@@ -58,12 +76,20 @@ func NewBlock(prevHeader *Header, txs []*Transaction) (*Block, error) {
 		return nil, err
 	}
 
+	// timestamp must be strictly greater than the parent timestamp
+	timestamp := time.Now().UnixNano()
+	if timestamp <= prevHeader.Timestamp {
+		timestamp = prevHeader.Timestamp + 1
+	}
+
 	header := &Header{
 		Version:       prevHeader.Version,
 		Height:        prevHeader.Height + 1,
-		Timestamp:     time.Now().UnixNano(),
+		Timestamp:     timestamp,
 		PrevBlockHash: prevHeader.Hash(),
 		DataHash:      dataHash,
+		StateRoot:     prevHeader.StateRoot,
+		ReceiptsRoot:  hash.ZeroHash,
 	}
 
 	block := &Block{
@@ -74,7 +100,10 @@ func NewBlock(prevHeader *Header, txs []*Transaction) (*Block, error) {
 	return block, nil
 }
 
+// Sign records address of the key pair as the block proposer and signs
+// the header.
 func (b *Block) Sign(kp *crypto.KeyPair) error {
+	b.Header.Proposer = kp.Address()
 	data := b.Header.Hash()
 	signature, err := kp.Sign(data)
 	if err != nil {
@@ -99,3 +128,19 @@ func (b *Block) Verify() error {
 	}
 	return nil
 }
+
+// ProveTransaction creates merkle inclusion proof of the transaction with
+// given hash against block data hash.
+func (b *Block) ProveTransaction(txhash hash.Hash) (*hash.MerkleProof, error) {
+	leaves := make([]hash.Hash, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		leaves[i] = tx.Hash()
+	}
+	return hash.NewMerkleProofFor(leaves, txhash)
+}
+
+// VerifyTransactionProof checks that the transaction with given hash is
+// included in the block with given header.
+func VerifyTransactionProof(h *Header, txhash hash.Hash, proof *hash.MerkleProof) error {
+	return proof.Verify(h.DataHash, txhash)
+}
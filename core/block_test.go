@@ -90,3 +90,29 @@ func TestBlockSignatureVerify(t *testing.T) {
 	require.NotEqual(t, x, y)
 	require.Equal(t, crypto.ErrInvalidSignature, block.Verify())
 }
+
+func TestBlockTransactionProof(t *testing.T) {
+	prevHeader := createGenesisHeader(t)
+
+	txs := []*Transaction{
+		createSignedTransaction(t, []byte("foo")),
+		createSignedTransaction(t, []byte("bar")),
+		createSignedTransaction(t, []byte("baz")),
+	}
+	block, err := NewBlock(prevHeader, txs)
+	require.Nil(t, err)
+
+	for _, tx := range txs {
+		proof, err := block.ProveTransaction(tx.Hash())
+		require.Nil(t, err)
+		require.Nil(t, VerifyTransactionProof(block.Header, tx.Hash(), proof))
+	}
+
+	other := createSignedTransaction(t, []byte("qux"))
+	_, err = block.ProveTransaction(other.Hash())
+	require.Equal(t, hash.ErrMerkleLeafNotFound, err)
+
+	proof, err := block.ProveTransaction(txs[0].Hash())
+	require.Nil(t, err)
+	require.Equal(t, hash.ErrMerkleProofNotVerified, VerifyTransactionProof(block.Header, other.Hash(), proof))
+}
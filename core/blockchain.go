@@ -2,42 +2,201 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
 	"github.com/rs/zerolog/log"
 )
 
+// number of blocks below the current tip for which side branches are kept,
+// a branch forking deeper can not be reorganised onto
+const SideBlockRetention = 64
+
 type BlockChain interface {
 	CurrentHeader() *Header
 	GetBlocks(uint32) ([]*Block, error)
 	CreateBlock(*crypto.KeyPair, []*Transaction) (*Block, error)
 	AddBlock(*Block) error
+	ChainID() uint32
+	GenesisHash() hash.Hash
+	GetAccount(crypto.Address) (*Account, error)
+	GetBlockByHash(hash.Hash) (*Block, error)
+	GetTransaction(hash.Hash) (*Transaction, *TxLocation, error)
+	GetReceipts(blockHash hash.Hash) ([]*Receipt, error)
+	GetReceipt(txHash hash.Hash) (*Receipt, error)
+	// GetStateProof proves the value of given state key against the
+	// state root of the returned canonical head.
+	GetStateProof(key []byte) (*StateProof, *Header, error)
+	// GetStateAt returns value of given state key after the canonical
+	// block at given height, if state of that block is retained.
+	GetStateAt(key []byte, height uint32) ([]byte, error)
+	// IterateState calls fn for every state key in range [start, end) in
+	// key order, until fn returns false, and returns the canonical head
+	// of the iterated state. Chain is read locked meanwhile, so fn must
+	// not call back into the chain.
+	IterateState(start, end []byte, fn func(k, v []byte) bool) *Header
+	// IterateStatePrefix is IterateState over keys with given prefix.
+	IterateStatePrefix(prefix []byte, fn func(k, v []byte) bool) *Header
+	// Subscribe delivers chain events of given types (every type if none
+	// given) through a channel buffering up to size events.
+	Subscribe(size int, types ...EventType) Subscription
+	// SubscribeLossless delivers chain events of given types like
+	// Subscribe, but queues events for a slow subscriber instead of
+	// dropping them.
+	SubscribeLossless(types ...EventType) Subscription
+}
+
+var (
+	ErrTxNotFound       = errors.New("transaction not found")
+	ErrStateNotRetained = errors.New("state of block is not retained")
+	ErrReorgTooDeep     = errors.New("branch forks below the blocks a reorg can undo")
+)
+
+// TxLocation locates a transaction included in the canonical chain.
+type TxLocation struct {
+	BlockHash hash.Hash
+	Height    uint32
+	Index     uint32 // position of the transaction in the block
+}
+
+// Reorg describes a switch of the canonical chain from one branch to
+// another. Dropped blocks are no longer part of the canonical chain,
+// Added blocks are applied on top of the common ancestor in order.
+type Reorg struct {
+	Ancestor *Header
+	OldHead  *Header
+	NewHead  *Header
+	Dropped  []*Block
+	Added    []*Block
 }
 
 type chain struct {
+	id            uint32
+	genesis       *Genesis
+	genesisHash   hash.Hash
+	blockGasLimit uint64
+	maxDrift      time.Duration
+	retention     uint32
 	storage       Storage
 	lock          sync.RWMutex
 	prevHeader    *Header
 	currHeader    *Header
 	contractState *State
+	genesisState  *State
+	history       map[uint32]*trieNode   // retained state trees by height
+	undo          map[uint32][]stateUndo // undo logs of recent blocks by height
+	headers       []*Header              // canonical headers by height
+	canonical     map[string]uint32      // canonical block hash to height
+	txIndex       map[string]*TxLocation // canonical transaction hash to location
+	sideBlocks    map[string]*Block      // known blocks outside the canonical chain
+	feed          *eventFeed
+	pending       []Event // events of the ongoing chain update
 }
 
-func NewBlockChain() (BlockChain, error) {
+func NewBlockChain(opts ...ChainOption) (BlockChain, error) {
+	options := createOptions(opts...)
+
+	genesisState, err := options.genesis.NewState()
+	if err != nil {
+		return nil, err
+	}
+
+	genesis, err := options.genesis.Block()
+	if err != nil {
+		return nil, err
+	}
+
+	// every hash of the chain must be created with the algorithm of the
+	// genesis spec, so nodes agree on them
+	if genesis.Header.Hash().Algorithm() != options.genesis.HashAlgorithm {
+		return nil, ErrGenesisHashAlgorithm
+	}
+
 	bc := &chain{
-		storage:       NewMemoryStorage(),
-		contractState: NewState(),
+		id:            options.genesis.ChainID,
+		genesis:       options.genesis,
+		genesisHash:   genesis.Header.Hash(),
+		blockGasLimit: options.blockGasLimit,
+		maxDrift:      options.maxTimestampDrift,
+		retention:     options.stateRetention,
+		storage:       options.storage,
+		contractState: genesisState.Copy(),
+		genesisState:  genesisState,
+		history:       make(map[uint32]*trieNode),
+		undo:          make(map[uint32][]stateUndo),
 		prevHeader:    nil,
 		currHeader:    nil,
+		headers:       []*Header{},
+		canonical:     make(map[string]uint32),
+		txIndex:       make(map[string]*TxLocation),
+		sideBlocks:    make(map[string]*Block),
+		feed:          newEventFeed(),
+	}
+
+	if bc.storage.Size() > 0 {
+		return bc, bc.recover(genesis)
 	}
 
-	genesis, err := GenesisBlock()
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	return bc, bc.finish(nil, bc.addBlock(genesis))
+}
+
+var ErrGenesisMismatch = errors.New("stored genesis block does not match")
+
+// recover rebuilds chain headers and contract state by replaying
+// every block found in storage.
+func (bc *chain) recover(genesis *Block) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	blocks, err := bc.storage.GetAll(0, uint32(bc.storage.Size()-1))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return bc, bc.addBlock(genesis)
+	if !blocks[0].Header.Hash().IsEqual(genesis.Header.Hash()) {
+		return ErrGenesisMismatch
+	}
+
+	if err := bc.replay(blocks); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("blockhash", bc.currHeader.Hash().String()).
+		Uint32("height", bc.currHeader.Height).
+		Msg("chain recovered from storage")
+
+	return nil
+}
+
+// replay resets chain headers and contract state, then applies given
+// blocks starting from genesis. Caller must hold the chain lock.
+func (bc *chain) replay(blocks []*Block) error {
+	bc.prevHeader = nil
+	bc.currHeader = nil
+	bc.headers = []*Header{}
+	bc.canonical = make(map[string]uint32)
+	bc.txIndex = make(map[string]*TxLocation)
+	bc.contractState = bc.genesisState.Copy()
+	bc.history = make(map[uint32]*trieNode)
+	bc.undo = make(map[uint32][]stateUndo)
+
+	for _, b := range blocks {
+		if bc.currHeader != nil && !b.Header.PrevBlockHash.IsEqual(bc.currHeader.Hash()) {
+			return ErrBlockPrevHeaderNotValid
+		}
+		if err := bc.applyBlock(b); err != nil {
+			return err
+		}
+	}
+	return nil
 }
+
 func (bc *chain) GetBlocks(from uint32) ([]*Block, error) {
 	bc.lock.RLock()
 	defer bc.lock.RUnlock()
@@ -50,12 +209,173 @@ func (bc *chain) CurrentHeader() *Header {
 	return bc.currHeader
 }
 
+func (bc *chain) ChainID() uint32 {
+	return bc.id
+}
+
+func (bc *chain) GenesisHash() hash.Hash {
+	return bc.genesisHash
+}
+
+func (bc *chain) GetAccount(addr crypto.Address) (*Account, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	return bc.contractState.GetAccount(addr), nil
+}
+
+// GetBlockByHash returns canonical or side branch block with given hash.
+func (bc *chain) GetBlockByHash(h hash.Hash) (*Block, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	if b, ok := bc.sideBlocks[h.String()]; ok {
+		return b, nil
+	}
+	return bc.storage.GetByHash(h)
+}
+
+// GetTransaction returns transaction with given hash and its location in
+// the canonical chain.
+func (bc *chain) GetTransaction(h hash.Hash) (*Transaction, *TxLocation, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	loc, ok := bc.txIndex[h.String()]
+	if !ok {
+		return nil, nil, ErrTxNotFound
+	}
+	b, err := bc.storage.Get(loc.Height)
+	if err != nil {
+		return nil, nil, err
+	}
+	location := *loc
+	return b.Transactions[loc.Index], &location, nil
+}
+
+// GetReceipts returns receipts of the canonical block with given hash.
+func (bc *chain) GetReceipts(h hash.Hash) ([]*Receipt, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	height, ok := bc.canonical[h.String()]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return bc.storage.GetReceipts(height)
+}
+
+// GetReceipt returns receipt of the canonical transaction with given hash.
+func (bc *chain) GetReceipt(h hash.Hash) (*Receipt, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	loc, ok := bc.txIndex[h.String()]
+	if !ok {
+		return nil, ErrTxNotFound
+	}
+	receipts, err := bc.storage.GetReceipts(loc.Height)
+	if err != nil {
+		return nil, err
+	}
+	return receipts[loc.Index], nil
+}
+
+func (bc *chain) GetStateProof(k []byte) (*StateProof, *Header, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	return bc.contractState.Prove(k), bc.currHeader, nil
+}
+
+func (bc *chain) GetStateAt(k []byte, height uint32) ([]byte, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	trie, ok := bc.history[height]
+	if !ok {
+		return nil, ErrStateNotRetained
+	}
+	v, ok := trieGet(trie, k)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStateKeyNotFound, k)
+	}
+	return v, nil
+}
+
+func (bc *chain) IterateState(start, end []byte, fn func(k, v []byte) bool) *Header {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	bc.contractState.Iterate(start, end, fn)
+	return bc.currHeader
+}
+
+func (bc *chain) IterateStatePrefix(prefix []byte, fn func(k, v []byte) bool) *Header {
+	start, end := prefixRange(prefix)
+	return bc.IterateState(start, end, fn)
+}
+
+func (bc *chain) Subscribe(size int, types ...EventType) Subscription {
+	return bc.feed.subscribe(size, types)
+}
+
+func (bc *chain) SubscribeLossless(types ...EventType) Subscription {
+	return bc.feed.subscribeLossless(types)
+}
+
+// finish completes a chain update which started at given head. Events
+// collected during a successful update are delivered to subscribers,
+// together with a new head event if the head changed; events of a failed
+// update are discarded. Caller must hold the chain lock.
+func (bc *chain) finish(head *Header, err error) error {
+	events := bc.pending
+	bc.pending = nil
+	if err != nil {
+		return err
+	}
+	if bc.currHeader != head {
+		events = append(events, &NewHeadEvent{Header: bc.currHeader})
+	}
+	if len(events) > 0 {
+		bc.feed.send(events)
+	}
+	return nil
+}
+
 func (bc *chain) CreateBlock(key *crypto.KeyPair, txs []*Transaction) (*Block, error) {
-	b, err := NewBlock(bc.CurrentHeader(), txs)
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	// transactions which can not be applied on current state are left
+	// out of the block
+	state := bc.contractState.Stage()
+	included := []*Transaction{}
+	receipts := []*Receipt{}
+	gasUsed := uint64(0)
+	for _, tx := range txs {
+		if bc.blockGasLimit-gasUsed < tx.GasLimit {
+			log.Warn().
+				Str("txhash", tx.Hash().String()).
+				Uint64("gasLimit", tx.GasLimit).
+				Msg("transaction does not fit into block gas limit")
+			continue
+		}
+		receipt, err := bc.applyTransaction(tx, state, key.Address())
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("txhash", tx.Hash().String()).
+				Msg("skipping transaction for new block")
+			continue
+		}
+		gasUsed += receipt.GasUsed
+		included = append(included, tx)
+		receipts = append(receipts, receipt)
+	}
+
+	b, err := NewBlock(bc.currHeader, included)
 	if err != nil {
 		return nil, err
 	}
 
+	// state and receipts roots are only known after executing block
+	// transactions
+	b.Header.StateRoot = state.Root()
+	b.Header.ReceiptsRoot = calculateReceiptsHash(receipts)
+
 	err = b.Sign(key)
 	if err != nil {
 		return nil, err
@@ -64,71 +384,399 @@ func (bc *chain) CreateBlock(key *crypto.KeyPair, txs []*Transaction) (*Block, e
 	if err := bc.validateBlock(b); err != nil {
 		return nil, err
 	}
-	return b, bc.addBlock(b)
+	head := bc.currHeader
+	return b, bc.finish(head, bc.storeBlock(b, state, receipts))
 }
 
+// AddBlock validates the given block and either extends the canonical
+// chain with it, or tracks it as part of a side branch. When a side
+// branch becomes longer than the canonical chain, the chain reorganizes
+// to that branch.
 func (bc *chain) AddBlock(b *Block) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	head := bc.currHeader
+	return bc.finish(head, bc.insertBlock(b))
+}
+
+// insertBlock implements AddBlock. Caller must hold the chain lock.
+func (bc *chain) insertBlock(b *Block) error {
 	if err := bc.validateBlock(b); err != nil {
 		return err
 	}
-	return bc.addBlock(b)
+
+	if b.Header.PrevBlockHash.IsEqual(bc.currHeader.Hash()) {
+		return bc.addBlock(b)
+	}
+
+	bc.sideBlocks[b.Header.Hash().String()] = b
+	log.Info().
+		Str("blockhash", b.Header.Hash().String()).
+		Uint32("height", b.Header.Height).
+		Msg("new side block")
+
+	// fork choice: longest chain wins, on equal height first seen is kept
+	if b.Header.Height <= bc.currHeader.Height {
+		return nil
+	}
+	return bc.reorganize(b)
 }
 
+// addBlock appends given block to the canonical chain. Caller must hold
+// the chain lock.
 func (bc *chain) addBlock(b *Block) error {
-	bc.lock.Lock()
-	defer bc.lock.Unlock()
-	if err := bc.storage.Put(b); err != nil {
+	state, receipts, err := bc.executeBlock(bc.contractState, b)
+	if err != nil {
+		return err
+	}
+	return bc.storeBlock(b, state, receipts)
+}
+
+// storeBlock writes already executed block and its receipts to storage
+// and commits it together with its staged state. Nothing is changed if
+// writing to storage fails. Caller must hold the chain lock.
+func (bc *chain) storeBlock(b *Block, state *State, receipts []*Receipt) error {
+	if err := bc.storage.Put(b, receipts); err != nil {
 		return err
 	}
+	if err := bc.commitBlock(b, state); err != nil {
+		return err
+	}
+	bc.blockAdded(b, receipts)
+	return nil
+}
+
+// blockAdded logs and queues events of a block which became canonical.
+// Caller must hold the chain lock.
+func (bc *chain) blockAdded(b *Block, receipts []*Receipt) {
+	log.Info().
+		Str("blockhash", b.Header.Hash().String()).
+		Uint32("height", b.Header.Height).
+		Int("transactions", len(b.Transactions)).
+		Msg("new block")
+
+	bc.pending = append(bc.pending, &BlockAddedEvent{Block: b, Receipts: receipts})
+	for i, tx := range b.Transactions {
+		bc.pending = append(bc.pending, &TxExecutedEvent{
+			Transaction: tx,
+			Receipt:     receipts[i],
+			Location: &TxLocation{
+				BlockHash: b.Header.Hash(),
+				Height:    b.Header.Height,
+				Index:     uint32(i),
+			},
+		})
+	}
+
+	bc.pruneSideBlocks()
+}
+
+// applyBlock executes given block and moves chain to it without touching
+// storage. Caller must hold the chain lock.
+func (bc *chain) applyBlock(b *Block) error {
+	state, _, err := bc.executeBlock(bc.contractState, b)
+	if err != nil {
+		return err
+	}
+	return bc.commitBlock(b, state)
+}
+
+// executeBlock runs block transactions against a state staged on top of
+// given parent state and checks the resulting state and receipts roots
+// against the block header. Parent state itself is not modified; on
+// failure the staged state is simply dropped. Caller must hold the chain
+// lock.
+func (bc *chain) executeBlock(parent *State, b *Block) (*State, []*Receipt, error) {
+	state := parent.Stage()
+	receipts, err := bc.runTransactions(b, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !b.Header.StateRoot.IsEqual(state.Root()) {
+		return nil, nil, ErrBlockStateRootNotValid
+	}
+	if !b.Header.ReceiptsRoot.IsEqual(calculateReceiptsHash(receipts)) {
+		return nil, nil, ErrBlockReceiptsRootNotValid
+	}
+	return state, receipts, nil
+}
+
+// commitBlock commits the staged state produced by executing given block
+// into contract state and moves chain headers to the block. Caller must
+// hold the chain lock.
+func (bc *chain) commitBlock(b *Block, state *State) error {
+	undo := state.undoLog()
+	if err := state.Commit(); err != nil {
+		return err
+	}
+	bc.advance(b, bc.contractState.trie, undo)
+	return nil
+}
+
+// advance moves chain headers to given block, whose state is already
+// committed into contract state, and records its state tree and undo
+// log. Caller must hold the chain lock.
+func (bc *chain) advance(b *Block, trie *trieNode, undo []stateUndo) {
 	bc.prevHeader = bc.currHeader
 	bc.currHeader = b.Header
+	bc.canonical[b.Header.Hash().String()] = b.Header.Height
+	bc.headers = append(bc.headers, b.Header)
+
+	// state trees share unchanged nodes, so retaining one per block only
+	// costs the nodes changed by the block
+	height := b.Header.Height
+	bc.history[height] = trie
+	if bc.retention > 0 && height >= bc.retention {
+		delete(bc.history, height-bc.retention)
+	}
+
+	// undo logs are kept as long as a side branch may still replace the
+	// block, see pruneSideBlocks
+	bc.undo[height] = undo
+	if height > SideBlockRetention {
+		delete(bc.undo, height-SideBlockRetention-1)
+	}
+
+	for i, tx := range b.Transactions {
+		bc.txIndex[tx.Hash().String()] = &TxLocation{
+			BlockHash: b.Header.Hash(),
+			Height:    b.Header.Height,
+			Index:     uint32(i),
+		}
+	}
+}
+
+// rewind moves chain headers back to given canonical ancestor, dropping
+// the given canonical blocks above it. Contract state is left to the
+// caller. Caller must hold the chain lock.
+func (bc *chain) rewind(ancestor *Header, dropped []*Block) {
+	for _, b := range dropped {
+		delete(bc.canonical, b.Header.Hash().String())
+		delete(bc.history, b.Header.Height)
+		delete(bc.undo, b.Header.Height)
+		for _, tx := range b.Transactions {
+			delete(bc.txIndex, tx.Hash().String())
+		}
+	}
+	bc.headers = bc.headers[:ancestor.Height+1]
+	bc.currHeader = ancestor
+	bc.prevHeader = nil
+	if ancestor.Height > 0 {
+		bc.prevHeader = bc.headers[ancestor.Height-1]
+	}
+}
+
+// reorganize switches the canonical chain to the branch ending with the
+// given side block. Contract state is rolled back to the common ancestor
+// with the undo logs of the dropped blocks, and the new branch is
+// executed on top of it on staged states. Storage and chain are only
+// changed once the whole branch executed successfully; a failing block
+// is dropped together with its descendants and the canonical chain is
+// kept. Caller must hold the chain lock.
+func (bc *chain) reorganize(head *Block) error {
+	branch := []*Block{}
+	for b := head; ; {
+		branch = append([]*Block{b}, branch...)
+		if _, ok := bc.canonical[b.Header.PrevBlockHash.String()]; ok {
+			break
+		}
+		parent, ok := bc.sideBlocks[b.Header.PrevBlockHash.String()]
+		if !ok {
+			return ErrBlockPrevHeaderNotValid
+		}
+		b = parent
+	}
+
+	ancestor := bc.headers[bc.canonical[branch[0].Header.PrevBlockHash.String()]]
+	oldHead := bc.currHeader
 
-	for id, tx := range b.Transactions {
-		vm := NewVM(tx.Data, bc.contractState)
+	base := bc.contractState.Stage()
+	for height := oldHead.Height; height > ancestor.Height; height-- {
+		undo, ok := bc.undo[height]
+		if !ok {
+			return ErrReorgTooDeep
+		}
+		base.undo(undo)
+	}
+	if !base.Root().IsEqual(ancestor.StateRoot) {
+		return ErrBlockStateRootNotValid
+	}
 
-		state, err := vm.Run()
+	states := make([]*State, len(branch))
+	receipts := make([][]*Receipt, len(branch))
+	parent := base
+	for i, b := range branch {
+		state, rs, err := bc.executeBlock(parent, b)
 		if err != nil {
+			log.Error().
+				Err(err).
+				Str("blockhash", b.Header.Hash().String()).
+				Msg("applying side branch failed, keeping canonical chain")
+			for _, b := range branch[i:] {
+				delete(bc.sideBlocks, b.Header.Hash().String())
+			}
 			return err
 		}
-		log.Info().
-			Str("blockhash", b.Header.Hash().String()).
-			Str("txhash", tx.Hash().String()).
-			Int("txSeq", id).
-			Msg("executed transaction")
+		states[i], receipts[i] = state, rs
+		parent = state
+	}
 
-		bc.contractState.Merge(state)
+	dropped, err := bc.storage.GetAll(ancestor.Height+1, oldHead.Height)
+	if err != nil {
+		return err
+	}
+	droppedReceipts := make([][]*Receipt, len(dropped))
+	for i, b := range dropped {
+		if droppedReceipts[i], err = bc.storage.GetReceipts(b.Header.Height); err != nil {
+			return err
+		}
+	}
+	if err := bc.writeBranch(ancestor.Height, branch, receipts); err != nil {
+		// put dropped blocks back, so storage matches the chain again
+		if rerr := bc.writeBranch(ancestor.Height, dropped, droppedReceipts); rerr != nil {
+			return rerr
+		}
+		return err
+	}
 
+	// undo logs and state trees are taken before the staged states are
+	// committed down into contract state
+	undos := make([][]stateUndo, len(branch))
+	tries := make([]*trieNode, len(branch))
+	for i, state := range states {
+		undos[i], tries[i] = state.undoLog(), state.trie
+	}
+	for i := len(states) - 1; i >= 0; i-- {
+		if err := states[i].Commit(); err != nil {
+			return err
+		}
+	}
+	if err := base.Commit(); err != nil {
+		return err
 	}
 
-	log.Info().
-		Str("blockhash", b.Header.Hash().String()).
-		Uint32("height", b.Header.Height).
-		Int("transactions", len(b.Transactions)).
-		Msg("new block")
+	bc.rewind(ancestor, dropped)
+	for i, b := range branch {
+		bc.advance(b, tries[i], undos[i])
+		bc.blockAdded(b, receipts[i])
+	}
+
+	for _, b := range dropped {
+		bc.sideBlocks[b.Header.Hash().String()] = b
+	}
+	for _, b := range branch {
+		delete(bc.sideBlocks, b.Header.Hash().String())
+	}
 
+	reorg := &Reorg{
+		Ancestor: ancestor,
+		OldHead:  oldHead,
+		NewHead:  bc.currHeader,
+		Dropped:  dropped,
+		Added:    branch,
+	}
+
+	log.Warn().
+		Str("ancestor", ancestor.Hash().String()).
+		Str("oldHead", oldHead.Hash().String()).
+		Str("newHead", bc.currHeader.Hash().String()).
+		Int("dropped", len(dropped)).
+		Int("added", len(branch)).
+		Msg("chain reorganized")
+
+	bc.pending = append(bc.pending, reorg)
 	return nil
 }
 
+// writeBranch rewinds storage to given height and writes given blocks
+// with their receipts on top of it. Caller must hold the chain lock.
+func (bc *chain) writeBranch(height uint32, blocks []*Block, receipts [][]*Receipt) error {
+	if err := bc.storage.Rewind(height); err != nil {
+		return err
+	}
+	for i, b := range blocks {
+		if err := bc.storage.Put(b, receipts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneSideBlocks removes side blocks which are too deep to ever
+// become canonical. Caller must hold the chain lock.
+func (bc *chain) pruneSideBlocks() {
+	if bc.currHeader.Height < SideBlockRetention {
+		return
+	}
+	limit := bc.currHeader.Height - SideBlockRetention
+	for key, b := range bc.sideBlocks {
+		if b.Header.Height < limit {
+			delete(bc.sideBlocks, key)
+		}
+	}
+}
+
+// lookupHeader finds a known header, either canonical or from a side
+// branch, by its hash. Caller must hold the chain lock.
+func (bc *chain) lookupHeader(h hash.Hash) (*Header, bool) {
+	if height, ok := bc.canonical[h.String()]; ok {
+		return bc.headers[height], true
+	}
+	if b, ok := bc.sideBlocks[h.String()]; ok {
+		return b.Header, true
+	}
+	return nil, false
+}
+
 var (
-	ErrBlockKnown              = errors.New("block already have")
-	ErrBlockTooHigh            = errors.New("block too high")
-	ErrBlockPrevHeaderNotValid = errors.New("hash of prev block is invalid")
+	ErrBlockKnown                = errors.New("block already have")
+	ErrBlockTooHigh              = errors.New("block too high")
+	ErrBlockPrevHeaderNotValid   = errors.New("hash of prev block is invalid")
+	ErrBlockUnknownParent        = errors.New("parent of block is unknown")
+	ErrBlockHeightNotValid       = errors.New("height of block is invalid")
+	ErrBlockStateRootNotValid    = errors.New("state root of block is invalid")
+	ErrBlockReceiptsRootNotValid = errors.New("receipts root of block is invalid")
+	ErrBlockSignerNotValid       = errors.New("block signer is not a validator")
+	ErrBlockProposerNotValid     = errors.New("block proposer does not match signer")
+	ErrBlockTimestampTooOld      = errors.New("block timestamp is not after parent timestamp")
+	ErrBlockTimestampTooNew      = errors.New("block timestamp is too far in the future")
 )
 
+// validateBlock checks given block against known headers. Caller must
+// hold the chain lock.
 func (bc *chain) validateBlock(b *Block) error {
-	if b.Header.Height <= bc.currHeader.Height {
+	if _, ok := bc.lookupHeader(b.Header.Hash()); ok {
 		return ErrBlockKnown
 	}
 
-	if b.Header.Height > bc.currHeader.Height+1 {
-		return ErrBlockTooHigh
+	parent, ok := bc.lookupHeader(b.Header.PrevBlockHash)
+	if !ok {
+		if b.Header.Height > bc.currHeader.Height+1 {
+			return ErrBlockTooHigh
+		}
+		return ErrBlockUnknownParent
 	}
 
-	if !b.Header.PrevBlockHash.IsEqual(bc.currHeader.Hash()) {
-		return ErrBlockPrevHeaderNotValid
+	if b.Header.Height != parent.Height+1 {
+		return ErrBlockHeightNotValid
 	}
 
-	// TODO (@igumus): add check prev header hash with block prev header hash
+	if b.Header.Timestamp <= parent.Timestamp {
+		return ErrBlockTimestampTooOld
+	}
+	if b.Header.Timestamp > time.Now().Add(bc.maxDrift).UnixNano() {
+		return ErrBlockTimestampTooNew
+	}
+
+	if err := b.Verify(); err != nil {
+		return err
+	}
 
-	return b.Verify()
+	if b.Header.Proposer != b.Signature.Address() {
+		return ErrBlockProposerNotValid
+	}
+	if !bc.genesis.IsValidator(b.Header.Proposer) {
+		return ErrBlockSignerNotValid
+	}
+	return nil
 }
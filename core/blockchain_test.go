@@ -1 +1,480 @@
 package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
+	"github.com/stretchr/testify/require"
+)
+
+// createStoreContract returns bytecode storing given value with given
+// single byte name in contract state.
+func createStoreContract(name byte, value byte) []byte {
+	return []byte{
+		0x01,
+		byte(InstrStrCreate),
+		name,
+		byte(InstrPushByte),
+		byte(InstrStrPack),
+		value,
+		byte(InstrPushInt),
+		byte(InstrStore),
+	}
+}
+
+// createdContract returns address of the contract created by given
+// contract transaction without recipient.
+func createdContract(tx *Transaction) crypto.Address {
+	return ContractAddress(tx.From(), tx.Nonce)
+}
+
+// createSignedCallTx returns a contract transaction running given
+// bytecode in the contract with given address.
+func createSignedCallTx(t *testing.T, kp *crypto.KeyPair, contract crypto.Address, data []byte, nonce uint64) *Transaction {
+	tx := NewTransaction(data)
+	tx.To = contract
+	tx.Nonce = nonce
+	require.Nil(t, tx.Sign(kp))
+	return tx
+}
+
+func TestBlockChainReopenFileStorage(t *testing.T) {
+	dir := t.TempDir()
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	storage, err := NewFileStorage(dir)
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithStorage(storage))
+	require.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := bc.CreateBlock(kp, []*Transaction{
+			createSignedTransaction(t, createStoreContract('f', 1)),
+		})
+		require.Nil(t, err)
+	}
+	tip := bc.CurrentHeader()
+	require.Nil(t, storage.Close())
+
+	storage, err = NewFileStorage(dir)
+	require.Nil(t, err)
+	defer storage.Close()
+
+	reopened, err := NewBlockChain(WithStorage(storage))
+	require.Nil(t, err)
+	require.Equal(t, tip.Height, reopened.CurrentHeader().Height)
+	require.Equal(t, tip.Hash(), reopened.CurrentHeader().Hash())
+
+	// reopened chain should keep extending the recovered tip
+	b, err := reopened.CreateBlock(kp, nil)
+	require.Nil(t, err)
+	require.Equal(t, tip.Height+1, b.Header.Height)
+}
+
+func TestBlockChainForkChoiceAndReorg(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	local, err := NewBlockChain()
+	require.Nil(t, err)
+	remote, err := NewBlockChain()
+	require.Nil(t, err)
+	reorgs := local.Subscribe(1, EventReorg)
+
+	localBlock, err := local.CreateBlock(kp, []*Transaction{
+		createSignedTransaction(t, createStoreContract('l', 1)),
+	})
+	require.Nil(t, err)
+
+	branch := []*Block{}
+	for i := 0; i < 2; i++ {
+		b, err := remote.CreateBlock(kp, []*Transaction{
+			createSignedTransaction(t, createStoreContract('r', 1)),
+		})
+		require.Nil(t, err)
+		branch = append(branch, b)
+	}
+
+	// competing block with same height is tracked, but not canonical
+	require.Nil(t, local.AddBlock(branch[0]))
+	require.Equal(t, localBlock.Header.Hash(), local.CurrentHeader().Hash())
+	require.Equal(t, ErrBlockKnown, local.AddBlock(branch[0]))
+
+	// longer branch wins
+	require.Nil(t, local.AddBlock(branch[1]))
+	require.Equal(t, branch[1].Header.Hash(), local.CurrentHeader().Hash())
+
+	reorg := (<-reorgs.Events()).(*Reorg)
+	require.Equal(t, uint32(0), reorg.Ancestor.Height)
+	require.Equal(t, localBlock.Header.Hash(), reorg.OldHead.Hash())
+	require.Equal(t, branch[1].Header.Hash(), reorg.NewHead.Hash())
+	require.Len(t, reorg.Dropped, 1)
+	require.Len(t, reorg.Added, 2)
+
+	blocks, err := local.GetBlocks(1)
+	require.Nil(t, err)
+	require.Len(t, blocks, 2)
+	require.Equal(t, branch[0].Header.Hash(), blocks[0].Header.Hash())
+
+	// dropped block is still known as side block
+	require.Equal(t, ErrBlockKnown, local.AddBlock(localBlock))
+}
+
+func TestBlockChainUnknownParent(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	local, err := NewBlockChain()
+	require.Nil(t, err)
+	_, err = local.CreateBlock(kp, nil)
+	require.Nil(t, err)
+
+	remote, err := NewBlockChain()
+	require.Nil(t, err)
+	blocks := []*Block{}
+	for i := 0; i < 3; i++ {
+		b, err := remote.CreateBlock(kp, nil)
+		require.Nil(t, err)
+		blocks = append(blocks, b)
+	}
+
+	require.Equal(t, ErrBlockUnknownParent, local.AddBlock(blocks[1]))
+	require.Equal(t, ErrBlockTooHigh, local.AddBlock(blocks[2]))
+}
+
+func TestBlockChainStateRoot(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	local, err := NewBlockChain()
+	require.Nil(t, err)
+	remote, err := NewBlockChain()
+	require.Nil(t, err)
+
+	txs := []*Transaction{
+		createSignedTransaction(t, createStoreContract('a', 1)),
+	}
+
+	b, err := remote.CreateBlock(kp, txs)
+	require.Nil(t, err)
+	require.NotEqual(t, b.Header.StateRoot, local.CurrentHeader().StateRoot)
+
+	// block claiming a different execution result is rejected
+	tampered, err := NewBlock(local.CurrentHeader(), txs)
+	require.Nil(t, err)
+	require.Nil(t, tampered.Sign(kp))
+	require.Equal(t, ErrBlockStateRootNotValid, local.AddBlock(tampered))
+	require.Equal(t, uint32(0), local.CurrentHeader().Height)
+
+	require.Nil(t, local.AddBlock(b))
+	require.Equal(t, b.Header.StateRoot, local.CurrentHeader().StateRoot)
+}
+
+func TestBlockChainReorgState(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	storage := NewMemoryStorage()
+	local, err := NewBlockChain(WithStorage(storage))
+	require.Nil(t, err)
+	remote, err := NewBlockChain()
+	require.Nil(t, err)
+
+	dropped := []crypto.Address{}
+	for i := 0; i < 2; i++ {
+		tx := createSignedTransaction(t, createStoreContract('a', byte(i+1)))
+		_, err := local.CreateBlock(kp, []*Transaction{tx})
+		require.Nil(t, err)
+		dropped = append(dropped, createdContract(tx))
+	}
+	localHead := local.CurrentHeader()
+
+	// side branch failing to execute leaves chain and storage untouched
+	invalid, err := NewBlock(remote.CurrentHeader(), []*Transaction{
+		createSignedTransaction(t, createStoreContract('b', 1)),
+	})
+	require.Nil(t, err)
+	require.Nil(t, invalid.Sign(kp))
+	require.Nil(t, local.AddBlock(invalid))
+	next, err := NewBlock(invalid.Header, nil)
+	require.Nil(t, err)
+	require.Nil(t, next.Sign(kp))
+	require.Nil(t, local.AddBlock(next))
+	child, err := NewBlock(next.Header, nil)
+	require.Nil(t, err)
+	require.Nil(t, child.Sign(kp))
+	require.Equal(t, ErrBlockStateRootNotValid, local.AddBlock(child))
+	require.Equal(t, localHead.Hash(), local.CurrentHeader().Hash())
+	require.Equal(t, 3, storage.Size())
+	stored, err := storage.Get(2)
+	require.Nil(t, err)
+	require.Equal(t, localHead.Hash(), stored.Header.Hash())
+
+	// valid longer branch replaces state changes of the dropped blocks
+	var contract crypto.Address
+	for i := 0; i < 3; i++ {
+		tx := createSignedTransaction(t, createStoreContract('b', byte(i+1)))
+		b, err := remote.CreateBlock(kp, []*Transaction{tx})
+		require.Nil(t, err)
+		require.Nil(t, local.AddBlock(b))
+		contract = createdContract(tx)
+	}
+	require.Equal(t, remote.CurrentHeader().Hash(), local.CurrentHeader().Hash())
+	require.Equal(t, 4, storage.Size())
+
+	for _, addr := range dropped {
+		_, err = local.GetStateAt(ContractKey(addr, []byte("a")), 3)
+		require.ErrorIs(t, err, ErrStateKeyNotFound)
+		_, err = local.GetStateAt(ContractKey(addr, []byte("a")), 1)
+		require.ErrorIs(t, err, ErrStateKeyNotFound)
+	}
+	v, err := local.GetStateAt(ContractKey(contract, []byte("b")), 3)
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), binary.LittleEndian.Uint64(v))
+
+	// chain keeps extending the new branch
+	b, err := local.CreateBlock(kp, []*Transaction{
+		createSignedTransaction(t, createStoreContract('a', 9)),
+	})
+	require.Nil(t, err)
+	require.Nil(t, remote.AddBlock(b))
+}
+
+type failingStorage struct {
+	Storage
+	fail bool
+}
+
+func (fs *failingStorage) Put(b *Block, receipts []*Receipt) error {
+	if fs.fail {
+		return errors.New("storage failure")
+	}
+	return fs.Storage.Put(b, receipts)
+}
+
+func TestBlockChainAtomicBlockApplication(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	receiver, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	storage := &failingStorage{Storage: NewMemoryStorage()}
+	local, err := NewBlockChain(WithStorage(storage), WithGenesisAlloc(sender.Address(), 100))
+	require.Nil(t, err)
+	remote, err := NewBlockChain(WithGenesisAlloc(sender.Address(), 100))
+	require.Nil(t, err)
+
+	b, err := remote.CreateBlock(sender, []*Transaction{
+		createSignedTransfer(t, sender, receiver.Address(), 10, 0),
+		createSignedTransaction(t, createStoreContract('a', 1)),
+	})
+	require.Nil(t, err)
+
+	storage.fail = true
+	require.NotNil(t, local.AddBlock(b))
+	require.Equal(t, uint32(0), local.CurrentHeader().Height)
+	account, err := local.GetAccount(sender.Address())
+	require.Nil(t, err)
+	require.Equal(t, uint64(100), account.Balance)
+	require.Equal(t, uint64(0), account.Nonce)
+
+	storage.fail = false
+	require.Nil(t, local.AddBlock(b))
+	require.Equal(t, b.Header.Hash(), local.CurrentHeader().Hash())
+	account, err = local.GetAccount(sender.Address())
+	require.Nil(t, err)
+	require.Equal(t, uint64(90), account.Balance)
+}
+
+func TestBlockChainLookupByHash(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	local, err := NewBlockChain()
+	require.Nil(t, err)
+	remote, err := NewBlockChain()
+	require.Nil(t, err)
+
+	localTx := createSignedTransaction(t, createStoreContract('l', 1))
+	localBlock, err := local.CreateBlock(kp, []*Transaction{
+		createSignedTransaction(t, createStoreContract('f', 1)),
+		localTx,
+	})
+	require.Nil(t, err)
+
+	b, err := local.GetBlockByHash(localBlock.Header.Hash())
+	require.Nil(t, err)
+	require.Equal(t, localBlock, b)
+
+	tx, loc, err := local.GetTransaction(localTx.Hash())
+	require.Nil(t, err)
+	require.Equal(t, localTx.Hash(), tx.Hash())
+	require.Equal(t, localBlock.Header.Hash(), loc.BlockHash)
+	require.Equal(t, uint32(1), loc.Height)
+	require.Equal(t, uint32(1), loc.Index)
+
+	_, err = local.GetBlockByHash(hash.CreateHash([]byte("foo")))
+	require.Equal(t, ErrBlockNotFound, err)
+	_, _, err = local.GetTransaction(hash.CreateHash([]byte("foo")))
+	require.Equal(t, ErrTxNotFound, err)
+
+	// transactions of blocks dropped by a reorg are no longer indexed
+	for i := 0; i < 2; i++ {
+		b, err := remote.CreateBlock(kp, []*Transaction{
+			createSignedTransaction(t, createStoreContract('r', 1)),
+		})
+		require.Nil(t, err)
+		require.Nil(t, local.AddBlock(b))
+	}
+	_, _, err = local.GetTransaction(localTx.Hash())
+	require.Equal(t, ErrTxNotFound, err)
+
+	// dropped block is still found as side block
+	b, err = local.GetBlockByHash(localBlock.Header.Hash())
+	require.Nil(t, err)
+	require.Equal(t, localBlock, b)
+}
+
+func TestBlockChainHeaderRules(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	other, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithMaxTimestampDrift(time.Minute))
+	require.Nil(t, err)
+	parent, err := bc.CreateBlock(kp, nil)
+	require.Nil(t, err)
+	require.Equal(t, kp.Address(), parent.Header.Proposer)
+
+	createBlock := func(timestamp int64) *Block {
+		b, err := NewBlock(parent.Header, nil)
+		require.Nil(t, err)
+		b.Header.Timestamp = timestamp
+		require.Nil(t, b.Sign(kp))
+		return b
+	}
+
+	require.Equal(t, ErrBlockTimestampTooOld, bc.AddBlock(createBlock(parent.Header.Timestamp)))
+	require.Equal(t, ErrBlockTimestampTooNew, bc.AddBlock(createBlock(time.Now().Add(2*time.Minute).UnixNano())))
+
+	// proposer must be the block signer
+	b := createBlock(parent.Header.Timestamp + 1)
+	b.Header.Proposer = other.Address()
+	b.Signature, err = kp.Sign(b.Header.Hash())
+	require.Nil(t, err)
+	require.Equal(t, ErrBlockProposerNotValid, bc.AddBlock(b))
+
+	require.Nil(t, bc.AddBlock(createBlock(parent.Header.Timestamp+1)))
+}
+
+func TestBlockChainStateAt(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithStateRetention(3))
+	require.Nil(t, err)
+	contract := ContractAddress(kp.Address(), 0)
+	for i := 0; i < 4; i++ {
+		to := contract
+		if i == 0 {
+			to = crypto.Address{}
+		}
+		tx := createSignedCallTx(t, kp, to, createStoreContract('a', byte(i)), uint64(i))
+		_, err := bc.CreateBlock(kp, []*Transaction{tx})
+		require.Nil(t, err)
+	}
+
+	// block at height i+1 stores i
+	for height := uint32(2); height <= 4; height++ {
+		v, err := bc.GetStateAt(ContractKey(contract, []byte("a")), height)
+		require.Nil(t, err)
+		require.Equal(t, uint64(height-1), binary.LittleEndian.Uint64(v))
+	}
+
+	_, err = bc.GetStateAt(ContractKey(contract, []byte("a")), 1)
+	require.Equal(t, ErrStateNotRetained, err)
+	_, err = bc.GetStateAt(ContractKey(contract, []byte("a")), 5)
+	require.Equal(t, ErrStateNotRetained, err)
+	_, err = bc.GetStateAt(ContractKey(contract, []byte("b")), 4)
+	require.ErrorIs(t, err, ErrStateKeyNotFound)
+}
+
+func TestBlockChainIterateState(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+	contract := ContractAddress(kp.Address(), 0)
+	_, err = bc.CreateBlock(kp, []*Transaction{
+		createSignedCallTx(t, kp, crypto.Address{}, createStoreContract('a', 1), 0),
+		createSignedCallTx(t, kp, contract, createStoreContract('b', 2), 1),
+		createSignedCallTx(t, kp, contract, createStoreContract('c', 3), 2),
+	})
+	require.Nil(t, err)
+
+	keys := []string{}
+	head := bc.IterateState(
+		ContractKey(contract, []byte("b")),
+		nil,
+		func(k, v []byte) bool {
+			keys = append(keys, string(k))
+			return true
+		})
+	require.Equal(t, bc.CurrentHeader(), head)
+	require.Equal(t, []string{
+		string(ContractKey(contract, []byte("b"))),
+		string(ContractKey(contract, []byte("c"))),
+	}, keys)
+
+	count := 0
+	bc.IterateStatePrefix(ContractKey(contract, nil), func(k, v []byte) bool {
+		count++
+		return true
+	})
+	require.Equal(t, 3, count)
+}
+
+func TestBlockChainContractIsolation(t *testing.T) {
+	creator, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	other, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+
+	created := createSignedCallTx(t, creator, crypto.Address{}, createStoreContract('a', 1), 0)
+	called := createSignedCallTx(t, creator, createdContract(created), createStoreContract('a', 2), 1)
+	// other sender can neither run bytecode in the contract, nor create a
+	// contract at its address
+	intruded := createSignedCallTx(t, other, createdContract(created), createStoreContract('a', 9), 0)
+	own := createSignedCallTx(t, other, crypto.Address{}, createStoreContract('a', 9), 1)
+	_, err = bc.CreateBlock(creator, []*Transaction{created, called, intruded, own})
+	require.Nil(t, err)
+
+	contract := createdContract(created)
+	require.Equal(t, ContractAddress(creator.Address(), 0), contract)
+	require.NotEqual(t, contract, createdContract(own))
+
+	receipt, err := bc.GetReceipt(intruded.Hash())
+	require.Nil(t, err)
+	require.Equal(t, ReceiptFailed, receipt.Status)
+	require.Equal(t, ReceiptCodeContractAddressNotValid, receipt.Code)
+	require.Equal(t, [][]byte{accountKey(other.Address())}, receipt.Writes)
+
+	value := func(addr crypto.Address) uint64 {
+		v, err := bc.GetStateAt(ContractKey(addr, []byte("a")), bc.CurrentHeader().Height)
+		require.Nil(t, err)
+		return binary.LittleEndian.Uint64(v)
+	}
+	require.Equal(t, uint64(2), value(contract))
+	require.Equal(t, uint64(9), value(createdContract(own)))
+}
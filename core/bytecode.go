@@ -0,0 +1,193 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrOperandMissing      = errors.New("instruction operand is missing")
+	ErrJumpTargetNotValid  = errors.New("jump target is not an instruction")
+	ErrStackHeightMismatch = errors.New("stack height differs between execution paths")
+)
+
+// BytecodeError reports the instruction at which bytecode is found to be
+// invalid.
+type BytecodeError struct {
+	Offset int // offset of the instruction opcode
+	Instr  Instruction
+	Err    error
+}
+
+func (e *BytecodeError) Error() string {
+	return fmt.Sprintf("bytecode offset %d (opcode 0x%02x): %s", e.Offset, byte(e.Instr), e.Err)
+}
+
+func (e *BytecodeError) Unwrap() error {
+	return e.Err
+}
+
+func newBytecodeError(data []byte, op int, err error) *BytecodeError {
+	return &BytecodeError{Offset: op, Instr: Instruction(data[op]), Err: err}
+}
+
+// instructionOperands is the number of operand bytes each instruction
+// takes. Operands are placed before their instruction, instructions not
+// listed take no operand.
+var instructionOperands = map[Instruction]int{
+	InstrPushInt:   1,
+	InstrPushByte:  1,
+	InstrStrCreate: 1,
+	InstrLoadRange: 1,
+	InstrJump:      2,
+	InstrJumpIf:    2,
+}
+
+// Operands returns number of operand bytes placed before the instruction.
+func (i Instruction) Operands() int {
+	return instructionOperands[i]
+}
+
+// bytecode is decoded contract data.
+type bytecode struct {
+	ops     []int       // offset of each instruction opcode, in order
+	targets map[int]int // instruction start offset to its index in ops
+}
+
+// decodeBytecode splits data into instructions. Since operands precede
+// their instruction, data is decoded backwards starting from the last
+// byte, which is always an instruction. Jump targets must be the start
+// offset (first operand byte) of an instruction.
+func decodeBytecode(data []byte) (*bytecode, *BytecodeError) {
+	ops := []int{}
+	for i := len(data) - 1; i >= 0; {
+		n := instructionOperands[Instruction(data[i])]
+		if i-n < 0 {
+			return nil, newBytecodeError(data, i, ErrOperandMissing)
+		}
+		ops = append(ops, i)
+		i -= n + 1
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+
+	code := &bytecode{
+		ops:     ops,
+		targets: make(map[int]int, len(ops)),
+	}
+	for i, op := range ops {
+		code.targets[op-instructionOperands[Instruction(data[op])]] = i
+	}
+	for _, op := range ops {
+		switch Instruction(data[op]) {
+		case InstrJump, InstrJumpIf:
+			if _, ok := code.targets[jumpTarget(data, op)]; !ok {
+				return nil, newBytecodeError(data, op, ErrJumpTargetNotValid)
+			}
+		}
+	}
+	return code, nil
+}
+
+// jumpTarget returns the 2 byte little endian target operand of the jump
+// instruction at given offset.
+func jumpTarget(data []byte, op int) int {
+	return int(binary.LittleEndian.Uint16(data[op-2 : op]))
+}
+
+// stackHeight is the range of possible stack heights before an
+// instruction, together with the size of the string being created.
+type stackHeight struct {
+	lo, hi  int
+	strSize int
+}
+
+// VerifyBytecode checks bytecode ahead of execution: every opcode must be
+// a known instruction with its operands present, jumps must target
+// instructions, and no execution path may underflow or overflow the
+// stack. Stack height before an instruction must be the same on every
+// path reaching it, so loops can not grow the stack. Returned errors are
+// of type *BytecodeError.
+func VerifyBytecode(data []byte) error {
+	if len(data) == 0 {
+		return &BytecodeError{Err: ErrBytecodeEmpty}
+	}
+	code, berr := decodeBytecode(data)
+	if berr != nil {
+		return berr
+	}
+
+	heights := make([]*stackHeight, len(code.ops))
+	heights[0] = &stackHeight{}
+	pending := []int{0}
+	for len(pending) > 0 {
+		idx := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		op := code.ops[idx]
+		instr := Instruction(data[op])
+		height := *heights[idx]
+
+		pops, pushLo, pushHi := 0, 0, 0
+		switch instr {
+		case InstrPushInt, InstrPushByte:
+			pushLo, pushHi = 1, 1
+		case InstrStrCreate:
+			height.strSize = int(data[op-1])
+		case InstrStrPack, InstrLoadState:
+			pops, pushLo, pushHi = height.strSize, 1, 1
+			height.strSize = 0
+		case InstrStore:
+			pops = 2
+		case InstrMultiply, InstrSub, InstrAdd, InstrLoadExternal,
+			InstrEq, InstrLt, InstrGt, InstrAnd, InstrOr:
+			pops, pushLo, pushHi = 2, 1, 1
+		case InstrNot:
+			pops, pushLo, pushHi = 1, 1, 1
+		case InstrLog, InstrJumpIf:
+			pops = 1
+		case InstrLoadRange:
+			// key and value of every loaded entry, followed by the count
+			pops, pushLo, pushHi = 2, 1, 2*int(data[op-1])+1
+		case InstrJump, InstrHalt:
+		default:
+			return newBytecodeError(data, op, ErrInstructionUnknown)
+		}
+
+		if height.lo < pops {
+			return newBytecodeError(data, op, ErrStackUnderflow)
+		}
+		height.lo += pushLo - pops
+		height.hi += pushHi - pops
+		if height.hi > stackSize {
+			return newBytecodeError(data, op, ErrStackOverflow)
+		}
+
+		next := []int{}
+		switch instr {
+		case InstrHalt:
+		case InstrJump:
+			next = append(next, code.targets[jumpTarget(data, op)])
+		case InstrJumpIf:
+			next = append(next, code.targets[jumpTarget(data, op)], idx+1)
+		default:
+			next = append(next, idx+1)
+		}
+		for _, n := range next {
+			if n == len(code.ops) {
+				continue
+			}
+			if heights[n] == nil {
+				h := height
+				heights[n] = &h
+				pending = append(pending, n)
+				continue
+			}
+			if *heights[n] != height {
+				return newBytecodeError(data, op, ErrStackHeightMismatch)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
+)
+
+// Canonical encoding is the byte layout of headers, transactions and
+// blocks used for hashing and signing. Unlike gob it does not depend on
+// type registration or stream state, so the same value always encodes to
+// the same bytes. Integers are little endian, variable sized fields
+// ("bytes") are prefixed with their length as uint32, and every structure
+// starts with the encoding version byte.
+//
+// Header (version 1):
+//
+//	version u8 | Version u32 | Height u32 | Timestamp i64 |
+//	PrevBlockHash bytes | DataHash bytes | StateRoot bytes |
+//	ReceiptsRoot bytes | Proposer [20]byte
+//
+// Transaction (version 1), signed part:
+//
+//	version u8 | ChainID u32 | Type u8 | To [20]byte | Value u64 |
+//	Nonce u64 | GasLimit u64 | GasPrice u64 | Data bytes
+//
+// followed by the signature:
+//
+//	present u8 | R bytes | S bytes | PubKey bytes (only if present is 1)
+//
+// Block (version 1):
+//
+//	version u8 | header | count u32 | count transactions | signature
+//
+// Receipt (version 1):
+//
+//	version u8 | TxHash bytes | Status u8 | Code u8 | GasUsed u64 |
+//	count u32 | count Writes bytes | count u32 | count Logs bytes
+//
+// Zero hashes and empty byte slices are both encoded as zero length bytes.
+const canonicalVersion byte = 0x1
+
+var (
+	ErrEncodingVersion   = errors.New("unknown canonical encoding version")
+	ErrEncodingMalformed = errors.New("malformed canonical encoding")
+)
+
+type canonicalWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *canonicalWriter) u8(v byte) {
+	w.buf.WriteByte(v)
+}
+
+func (w *canonicalWriter) u32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *canonicalWriter) u64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *canonicalWriter) bytes(b []byte) {
+	w.u32(uint32(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *canonicalWriter) header(h *Header) {
+	w.u8(canonicalVersion)
+	w.u32(h.Version)
+	w.u32(h.Height)
+	w.u64(uint64(h.Timestamp))
+	w.bytes(h.PrevBlockHash.Bytes())
+	w.bytes(h.DataHash.Bytes())
+	w.bytes(h.StateRoot.Bytes())
+	w.bytes(h.ReceiptsRoot.Bytes())
+	w.buf.Write(h.Proposer.Bytes())
+}
+
+func (w *canonicalWriter) unsignedTransaction(tx *Transaction) {
+	w.u8(canonicalVersion)
+	w.u32(tx.ChainID)
+	w.u8(byte(tx.Type))
+	w.buf.Write(tx.To.Bytes())
+	w.u64(tx.Value)
+	w.u64(tx.Nonce)
+	w.u64(tx.GasLimit)
+	w.u64(tx.GasPrice)
+	w.bytes(tx.Data)
+}
+
+func (w *canonicalWriter) signature(s *crypto.Signature) {
+	if s == nil {
+		w.u8(0)
+		return
+	}
+	w.u8(1)
+	w.bytes(s.R.Bytes())
+	w.bytes(s.S.Bytes())
+	w.bytes(s.PubKey)
+}
+
+func (w *canonicalWriter) transaction(tx *Transaction) {
+	w.unsignedTransaction(tx)
+	w.signature(tx.Signature)
+}
+
+func (w *canonicalWriter) block(b *Block) {
+	w.u8(canonicalVersion)
+	w.header(b.Header)
+	w.u32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		w.transaction(tx)
+	}
+	w.signature(b.Signature)
+}
+
+func (w *canonicalWriter) receipt(r *Receipt) {
+	w.u8(canonicalVersion)
+	w.bytes(r.TxHash.Bytes())
+	w.u8(byte(r.Status))
+	w.u8(byte(r.Code))
+	w.u64(r.GasUsed)
+	w.u32(uint32(len(r.Writes)))
+	for _, k := range r.Writes {
+		w.bytes(k)
+	}
+	w.u32(uint32(len(r.Logs)))
+	for _, l := range r.Logs {
+		w.bytes(l)
+	}
+}
+
+// canonicalReader decodes canonical encoding. The first error is kept
+// and every following read becomes a no-op.
+type canonicalReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func newCanonicalReader(b []byte) *canonicalReader {
+	return &canonicalReader{r: bytes.NewReader(b)}
+}
+
+func (r *canonicalReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > r.r.Len() {
+		r.err = ErrEncodingMalformed
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.err = ErrEncodingMalformed
+		return nil
+	}
+	return b
+}
+
+func (r *canonicalReader) u8() byte {
+	b := r.read(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *canonicalReader) u32() uint32 {
+	b := r.read(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *canonicalReader) u64() uint64 {
+	b := r.read(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *canonicalReader) bytes() []byte {
+	n := r.u32()
+	if n == 0 {
+		return nil
+	}
+	return r.read(int(n))
+}
+
+func (r *canonicalReader) version() {
+	if v := r.u8(); r.err == nil && v != canonicalVersion {
+		r.err = ErrEncodingVersion
+	}
+}
+
+func (r *canonicalReader) hash() hash.Hash {
+	b := r.bytes()
+	if b == nil || r.err != nil {
+		return hash.ZeroHash
+	}
+	h, err := hash.FromBytes(b)
+	if err != nil {
+		r.err = err
+		return hash.ZeroHash
+	}
+	return h
+}
+
+func (r *canonicalReader) header() *Header {
+	r.version()
+	h := &Header{
+		Version:   r.u32(),
+		Height:    r.u32(),
+		Timestamp: int64(r.u64()),
+	}
+	h.PrevBlockHash = r.hash()
+	h.DataHash = r.hash()
+	h.StateRoot = r.hash()
+	h.ReceiptsRoot = r.hash()
+	if proposer := r.read(len(h.Proposer)); proposer != nil {
+		h.Proposer = crypto.AddressFromBytes(proposer)
+	}
+	return h
+}
+
+func (r *canonicalReader) signature() *crypto.Signature {
+	switch r.u8() {
+	case 0:
+		return nil
+	case 1:
+		s := &crypto.Signature{
+			R:      new(big.Int).SetBytes(r.bytes()),
+			S:      new(big.Int).SetBytes(r.bytes()),
+			PubKey: r.bytes(),
+		}
+		if r.err == nil && crypto.ValidatePublicKey(s.PubKey) != nil {
+			r.err = crypto.ErrInvalidPublicKey
+		}
+		return s
+	default:
+		r.err = ErrEncodingMalformed
+		return nil
+	}
+}
+
+func (r *canonicalReader) transaction() *Transaction {
+	r.version()
+	tx := &Transaction{
+		ChainID: r.u32(),
+		Type:    TxType(r.u8()),
+	}
+	if to := r.read(len(tx.To)); to != nil {
+		tx.To = crypto.AddressFromBytes(to)
+	}
+	tx.Value = r.u64()
+	tx.Nonce = r.u64()
+	tx.GasLimit = r.u64()
+	tx.GasPrice = r.u64()
+	tx.Data = r.bytes()
+	tx.Signature = r.signature()
+	return tx
+}
+
+func (r *canonicalReader) block() *Block {
+	r.version()
+	b := &Block{Header: r.header()}
+	count := r.u32()
+	// every transaction takes at least 63 bytes, so a count larger than
+	// the remaining input can not be valid
+	if r.err == nil && int(count) > r.r.Len() {
+		r.err = ErrEncodingMalformed
+		return nil
+	}
+	b.Transactions = make([]*Transaction, 0, count)
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		b.Transactions = append(b.Transactions, r.transaction())
+	}
+	b.Signature = r.signature()
+	return b
+}
+
+// list decodes count prefixed byte slices.
+func (r *canonicalReader) list() [][]byte {
+	count := r.u32()
+	// every entry takes at least its 4 byte length
+	if r.err == nil && int(count) > r.r.Len() {
+		r.err = ErrEncodingMalformed
+		return nil
+	}
+	result := make([][]byte, 0, count)
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		result = append(result, r.bytes())
+	}
+	return result
+}
+
+func (r *canonicalReader) receipt() *Receipt {
+	r.version()
+	receipt := &Receipt{
+		TxHash: r.hash(),
+		Status: ReceiptStatus(r.u8()),
+		Code:   ReceiptCode(r.u8()),
+	}
+	receipt.GasUsed = r.u64()
+	receipt.Writes = r.list()
+	receipt.Logs = r.list()
+	return receipt
+}
+
+// done returns the first decoding error, or ErrEncodingMalformed if
+// input is not fully consumed.
+func (r *canonicalReader) done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.r.Len() != 0 {
+		return ErrEncodingMalformed
+	}
+	return nil
+}
+
+// HeaderFromBytes decodes canonically encoded header.
+func HeaderFromBytes(b []byte) (*Header, error) {
+	r := newCanonicalReader(b)
+	h := r.header()
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// TransactionFromBytes decodes canonically encoded transaction.
+func TransactionFromBytes(b []byte) (*Transaction, error) {
+	r := newCanonicalReader(b)
+	tx := r.transaction()
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// BlockFromBytes decodes canonically encoded block.
+func BlockFromBytes(b []byte) (*Block, error) {
+	r := newCanonicalReader(b)
+	block := r.block()
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (h *Header) MarshalCanonical() ([]byte, error) {
+	return h.Bytes(), nil
+}
+
+func (h *Header) UnmarshalCanonical(b []byte) error {
+	decoded, err := HeaderFromBytes(b)
+	if err != nil {
+		return err
+	}
+	*h = *decoded
+	return nil
+}
+
+func (tx *Transaction) MarshalCanonical() ([]byte, error) {
+	return tx.Bytes(), nil
+}
+
+func (tx *Transaction) UnmarshalCanonical(b []byte) error {
+	decoded, err := TransactionFromBytes(b)
+	if err != nil {
+		return err
+	}
+	*tx = *decoded
+	return nil
+}
+
+func (b *Block) MarshalCanonical() ([]byte, error) {
+	return b.Bytes(), nil
+}
+
+func (b *Block) UnmarshalCanonical(data []byte) error {
+	decoded, err := BlockFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*b = *decoded
+	return nil
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalHeaderLayout(t *testing.T) {
+	h := &Header{
+		Version:       1,
+		Height:        2,
+		Timestamp:     3,
+		PrevBlockHash: hash.ZeroHash,
+		DataHash:      hash.ZeroHash,
+		StateRoot:     hash.ZeroHash,
+		ReceiptsRoot:  hash.ZeroHash,
+	}
+
+	expected := "01" + // encoding version
+		"01000000" + // version
+		"02000000" + // height
+		"0300000000000000" + // timestamp
+		"00000000" + "00000000" + "00000000" + "00000000" + // empty hashes
+		"0000000000000000000000000000000000000000" // proposer
+	require.Equal(t, expected, hex.EncodeToString(h.Bytes()))
+
+	decoded, err := HeaderFromBytes(h.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, h, decoded)
+}
+
+func TestCanonicalTransaction(t *testing.T) {
+	key, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	tx := NewTransferTransaction(crypto.Address{0x01}, 10, 3)
+	tx.GasPrice = 2
+	tx.Data = []byte("foo")
+	require.Nil(t, tx.Sign(key))
+
+	decoded, err := TransactionFromBytes(tx.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, tx.Bytes(), decoded.Bytes())
+	require.Equal(t, tx.Hash(), decoded.Hash())
+	require.Nil(t, decoded.Verify())
+
+	unsigned, err := TransactionFromBytes(NewTransaction(nil).Bytes())
+	require.Nil(t, err)
+	require.Nil(t, unsigned.Signature)
+
+	// malformed public keys are rejected when decoding, and fail
+	// verification instead of panicking
+	tx.Signature.PubKey = []byte{1, 2, 3}
+	_, err = TransactionFromBytes(tx.Bytes())
+	require.Equal(t, crypto.ErrInvalidPublicKey, err)
+	require.Equal(t, crypto.ErrInvalidSignature, tx.Verify())
+
+	txpool, err := NewTXPool()
+	require.Nil(t, err)
+	require.Equal(t, crypto.ErrInvalidSignature, txpool.Add(tx))
+}
+
+func TestCanonicalBlock(t *testing.T) {
+	key, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	genesis, err := GenesisBlock()
+	require.Nil(t, err)
+
+	b, err := NewBlock(genesis.Header, []*Transaction{
+		createSignedTransaction(t, []byte("foo")),
+		createSignedTransaction(t, []byte("bar")),
+	})
+	require.Nil(t, err)
+	require.Nil(t, b.Sign(key))
+
+	decoded, err := BlockFromBytes(b.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, b.Bytes(), decoded.Bytes())
+	require.Equal(t, b.Header.Hash(), decoded.Header.Hash())
+	require.Len(t, decoded.Transactions, 2)
+	require.Nil(t, decoded.Verify())
+}
+
+func TestCanonicalMalformed(t *testing.T) {
+	genesis, err := GenesisBlock()
+	require.Nil(t, err)
+	data := genesis.Bytes()
+
+	_, err = BlockFromBytes(data[:len(data)-1])
+	require.Equal(t, ErrEncodingMalformed, err)
+
+	_, err = BlockFromBytes(append(data, 0x00))
+	require.Equal(t, ErrEncodingMalformed, err)
+
+	_, err = HeaderFromBytes(append([]byte{0x02}, genesis.Header.Bytes()[1:]...))
+	require.Equal(t, ErrEncodingVersion, err)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
+)
+
+// values of each contract are kept in contract state under this prefix
+// followed by the contract address, so contracts can not overwrite each
+// other's values
+var contractKeyPrefix = []byte("contract/")
+
+// creator of each contract is kept in contract state under this prefix
+// followed by the contract address
+var contractCreatorPrefix = []byte("\x00creator/")
+
+// ContractKey returns the state key holding given key of the contract
+// with given address.
+func ContractKey(addr crypto.Address, k []byte) []byte {
+	return bytes.Join([][]byte{contractNamespace(addr), k}, []byte{})
+}
+
+func contractNamespace(addr crypto.Address) []byte {
+	return bytes.Join([][]byte{contractKeyPrefix, addr.Bytes()}, []byte{})
+}
+
+// ContractAddress returns address of the contract created by the contract
+// transaction of given sender with given nonce. Addresses are derived
+// rather than chosen, so no sender can create a contract at the address
+// of another one.
+func ContractAddress(creator crypto.Address, nonce uint64) crypto.Address {
+	buf := binary.LittleEndian.AppendUint64(creator.Bytes(), nonce)
+	return crypto.AddressFromBytes(hash.CreateHash(buf))
+}
+
+func contractCreatorKey(addr crypto.Address) []byte {
+	return bytes.Join([][]byte{contractCreatorPrefix, addr.Bytes()}, []byte{})
+}
+
+// contractAddress returns the contract which bytecode of the transaction
+// runs in and whether the transaction creates it. A transaction without
+// recipient creates a new contract, other transactions run in the
+// recipient contract, which only its creator may do.
+func contractAddress(tx *Transaction, from crypto.Address, state *State) (crypto.Address, bool, error) {
+	if tx.To == (crypto.Address{}) {
+		return ContractAddress(from, tx.Nonce), true, nil
+	}
+	creator, ok := state.lookup(string(contractCreatorKey(tx.To)))
+	if !ok || !bytes.Equal(creator, from.Bytes()) {
+		return crypto.Address{}, false, ErrContractAddressNotValid
+	}
+	return tx.To, false, nil
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContractNamespace(t *testing.T) {
+	state := NewState()
+	first, second := crypto.Address{1}, crypto.Address{2}
+
+	require.Nil(t, NewVM(createStoreContract('a', 1), first, state).Run())
+	require.Nil(t, NewVM(createStoreContract('a', 2), second, state).Run())
+
+	value := func(addr crypto.Address) uint64 {
+		v, err := state.Get(ContractKey(addr, []byte("a")))
+		require.Nil(t, err)
+		return binary.LittleEndian.Uint64(v)
+	}
+	require.Equal(t, uint64(1), value(first))
+	require.Equal(t, uint64(2), value(second))
+
+	// contracts only load their own values
+	load := []byte{0x01, byte(InstrStrCreate), 'a', byte(InstrPushByte), byte(InstrLoadState)}
+	vm := NewVM(load, crypto.Address{3}, state)
+	require.ErrorIs(t, vm.Run(), ErrStateKeyNotFound)
+}
+
+func TestVMInstrLoadExternal(t *testing.T) {
+	state := NewState()
+	other := crypto.Address{0xaa}
+	state.Put(ContractKey(other, []byte("a")), []byte{7})
+
+	vm := NewVM(nil, crypto.Address{1}, state)
+	vm.stack.push(other.Bytes())
+	vm.stack.push([]byte("a"))
+	require.Nil(t, vm.exec(InstrLoadExternal))
+	require.Equal(t, []byte{7}, vm.stack.pop())
+	require.Equal(t, 0, vm.stack.sp)
+
+	// address must be 20 bytes long
+	vm.stack.push([]byte{0xaa})
+	vm.stack.push([]byte("a"))
+	require.Equal(t, ErrContractAddressNotValid, vm.exec(InstrLoadExternal))
+}
@@ -2,28 +2,140 @@ package core
 
 import (
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"io"
 )
 
-func generateGobDecoder[T Block | Header | Transaction]() func(io.Reader, *T) error {
+var (
+	ErrUnknownCodec      = errors.New("unknown codec")
+	ErrCodecNotSupported = errors.New("value not supported by codec")
+)
+
+// Codec encodes values exchanged between nodes (blocks, transactions and
+// node messages).
+type Codec interface {
+	Name() string
+	Encode(io.Writer, any) error
+	Decode(io.Reader, any) error
+}
+
+// CanonicalMarshaler is implemented by values which have a canonical
+// binary encoding.
+type CanonicalMarshaler interface {
+	MarshalCanonical() ([]byte, error)
+}
+
+// CanonicalUnmarshaler is implemented by values which can be decoded from
+// their canonical binary encoding.
+type CanonicalUnmarshaler interface {
+	UnmarshalCanonical([]byte) error
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Encode(w io.Writer, v any) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func (gobCodec) Decode(r io.Reader, v any) error {
+	return gob.NewDecoder(r).Decode(v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// canonicalCodec only supports values implementing CanonicalMarshaler
+// and CanonicalUnmarshaler.
+type canonicalCodec struct{}
+
+func (canonicalCodec) Name() string {
+	return "canonical"
+}
+
+func (canonicalCodec) Encode(w io.Writer, v any) error {
+	m, ok := v.(CanonicalMarshaler)
+	if !ok {
+		return ErrCodecNotSupported
+	}
+	data, err := m.MarshalCanonical()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (canonicalCodec) Decode(r io.Reader, v any) error {
+	u, ok := v.(CanonicalUnmarshaler)
+	if !ok {
+		return ErrCodecNotSupported
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return u.UnmarshalCanonical(data)
+}
+
+var (
+	GobCodec       Codec = gobCodec{}
+	JSONCodec      Codec = jsonCodec{}
+	CanonicalCodec Codec = canonicalCodec{}
+
+	// codec used when none is negotiated
+	DefaultCodec = GobCodec
+)
+
+// Codecs returns every known codec.
+func Codecs() []Codec {
+	return []Codec{GobCodec, JSONCodec, CanonicalCodec}
+}
+
+// LookupCodec returns codec with given name.
+func LookupCodec(name string) (Codec, error) {
+	for _, c := range Codecs() {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, ErrUnknownCodec
+}
+
+func generateDecoder[T Block | Header | Transaction](c Codec) func(io.Reader, *T) error {
 	return func(r io.Reader, t *T) error {
-		return gob.NewDecoder(r).Decode(t)
+		return c.Decode(r, t)
 	}
 }
 
-func generateGobEncoder[T Block | Header | Transaction]() func(io.Writer, *T) error {
+func generateEncoder[T Block | Header | Transaction](c Codec) func(io.Writer, *T) error {
 	return func(w io.Writer, t *T) error {
-		return gob.NewEncoder(w).Encode(t)
+		return c.Encode(w, t)
 	}
 }
 
 var (
-	EncodeTransaction = generateGobEncoder[Transaction]()
-	DecodeTransaction = generateGobDecoder[Transaction]()
+	EncodeTransaction = generateEncoder[Transaction](DefaultCodec)
+	DecodeTransaction = generateDecoder[Transaction](DefaultCodec)
 
-	EncodeBlock = generateGobEncoder[Block]()
-	DecodeBlock = generateGobDecoder[Block]()
+	EncodeBlock = generateEncoder[Block](DefaultCodec)
+	DecodeBlock = generateDecoder[Block](DefaultCodec)
 
-	EncodeHeader = generateGobEncoder[Header]()
-	DecodeHeader = generateGobDecoder[Header]()
+	EncodeHeader = generateEncoder[Header](DefaultCodec)
+	DecodeHeader = generateDecoder[Header](DefaultCodec)
 )
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/igumus/chainx/crypto"
 	"github.com/igumus/chainx/hash"
 	"github.com/stretchr/testify/require"
 )
@@ -31,3 +32,36 @@ func TestEncodingBlock(t *testing.T) {
 	require.Equal(t, block.Header.PrevBlockHash, dblock.Header.PrevBlockHash)
 	require.Equal(t, block.Header.DataHash, dblock.Header.DataHash)
 }
+
+func TestCodecs(t *testing.T) {
+	key, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	genesis, err := GenesisBlock()
+	require.Nil(t, err)
+
+	block, err := NewBlock(genesis.Header, []*Transaction{createSignedTransaction(t, []byte("foo"))})
+	require.Nil(t, err)
+	require.Nil(t, block.Sign(key))
+
+	for _, codec := range Codecs() {
+		t.Run(codec.Name(), func(t *testing.T) {
+			found, err := LookupCodec(codec.Name())
+			require.Nil(t, err)
+			require.Equal(t, codec, found)
+
+			buf := new(bytes.Buffer)
+			require.Nil(t, codec.Encode(buf, block))
+
+			decoded := &Block{}
+			require.Nil(t, codec.Decode(buf, decoded))
+			require.Equal(t, block.Bytes(), decoded.Bytes())
+			require.Nil(t, decoded.Verify())
+		})
+	}
+
+	_, err = LookupCodec("xml")
+	require.Equal(t, ErrUnknownCodec, err)
+
+	require.Equal(t, ErrCodecNotSupported, CanonicalCodec.Encode(new(bytes.Buffer), "foo"))
+}
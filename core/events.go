@@ -0,0 +1,228 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+type EventType byte
+
+const (
+	// canonical head of the chain changed
+	EventNewHead EventType = 0x1
+	// block is appended to the canonical chain
+	EventBlockAdded EventType = 0x2
+	// transaction of a canonical block is executed
+	EventTxExecuted EventType = 0x3
+	// canonical chain switched to another branch
+	EventReorg EventType = 0x4
+)
+
+// Event is delivered to chain subscribers. Concrete event types are
+// *NewHeadEvent, *BlockAddedEvent, *TxExecutedEvent and *Reorg.
+type Event interface {
+	Type() EventType
+}
+
+type NewHeadEvent struct {
+	Header *Header
+}
+
+func (*NewHeadEvent) Type() EventType {
+	return EventNewHead
+}
+
+type BlockAddedEvent struct {
+	Block    *Block
+	Receipts []*Receipt
+}
+
+func (*BlockAddedEvent) Type() EventType {
+	return EventBlockAdded
+}
+
+type TxExecutedEvent struct {
+	Transaction *Transaction
+	Receipt     *Receipt
+	Location    *TxLocation
+}
+
+func (*TxExecutedEvent) Type() EventType {
+	return EventTxExecuted
+}
+
+func (*Reorg) Type() EventType {
+	return EventReorg
+}
+
+// Subscription delivers chain events in the order they happened. Events
+// are never blocked on a slow subscriber: once the buffer of the
+// subscription is full, further events are dropped and counted until
+// the subscriber catches up. Lossless subscriptions queue such events
+// instead, without bound, so they never drop any.
+type Subscription interface {
+	Events() <-chan Event
+	// Dropped returns number of events dropped because of a full buffer.
+	Dropped() uint64
+	// Unsubscribe stops delivery and closes the events channel.
+	Unsubscribe()
+}
+
+type subscription struct {
+	feed    *eventFeed
+	ch      chan Event
+	types   map[EventType]struct{}
+	dropped uint64
+
+	// events waiting for delivery, lossless subscriptions only
+	lossless bool
+	lock     sync.Mutex
+	queue    []Event
+	notify   chan struct{} // signals queued events
+	quit     chan struct{} // closed on unsubscribe
+}
+
+func (s *subscription) Events() <-chan Event {
+	return s.ch
+}
+
+func (s *subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *subscription) Unsubscribe() {
+	s.feed.unsubscribe(s)
+}
+
+// enqueue queues given event for delivery on a lossless subscription.
+func (s *subscription) enqueue(e Event) {
+	s.lock.Lock()
+	s.queue = append(s.queue, e)
+	s.lock.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliver moves queued events of a lossless subscription to its channel
+// until the subscription is closed.
+func (s *subscription) deliver() {
+	defer close(s.ch)
+	for {
+		s.lock.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.lock.Unlock()
+
+		for _, e := range queue {
+			select {
+			case s.ch <- e:
+			case <-s.quit:
+				return
+			}
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *subscription) accepts(e Event) bool {
+	if len(s.types) == 0 {
+		return true
+	}
+	_, ok := s.types[e.Type()]
+	return ok
+}
+
+// eventFeed fans out chain events to subscriptions.
+type eventFeed struct {
+	lock sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+func newEventFeed() *eventFeed {
+	return &eventFeed{
+		subs: make(map[*subscription]struct{}),
+	}
+}
+
+func (f *eventFeed) subscribe(size int, types []EventType) *subscription {
+	s := f.newSubscription(size, types)
+	f.register(s)
+	return s
+}
+
+func (f *eventFeed) subscribeLossless(types []EventType) *subscription {
+	s := f.newSubscription(0, types)
+	s.lossless = true
+	s.notify = make(chan struct{}, 1)
+	s.quit = make(chan struct{})
+	go s.deliver()
+	f.register(s)
+	return s
+}
+
+func (f *eventFeed) newSubscription(size int, types []EventType) *subscription {
+	s := &subscription{
+		feed:  f,
+		ch:    make(chan Event, size),
+		types: make(map[EventType]struct{}),
+	}
+	for _, t := range types {
+		s.types[t] = struct{}{}
+	}
+	return s
+}
+
+// register adds a fully initialised subscription to the feed, events
+// are sent to it from now on.
+func (f *eventFeed) register(s *subscription) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.subs[s] = struct{}{}
+}
+
+func (f *eventFeed) unsubscribe(s *subscription) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.subs[s]; !ok {
+		return
+	}
+	delete(f.subs, s)
+	if s.lossless {
+		// delivery goroutine closes the channel
+		close(s.quit)
+		return
+	}
+	close(s.ch)
+}
+
+func (f *eventFeed) send(events []Event) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for s := range f.subs {
+		for _, e := range events {
+			if !s.accepts(e) {
+				continue
+			}
+			if s.lossless {
+				s.enqueue(e)
+				continue
+			}
+			select {
+			case s.ch <- e:
+			default:
+				if atomic.AddUint64(&s.dropped, 1) == 1 {
+					log.Warn().Msg("chain subscription buffer is full, dropping events")
+				}
+			}
+		}
+	}
+}
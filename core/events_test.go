@@ -0,0 +1,127 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeBlockEvents(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+	sub := bc.Subscribe(16)
+	defer sub.Unsubscribe()
+
+	tx := createSignedTransaction(t, createStoreContract('a', 1))
+	b, err := bc.CreateBlock(kp, []*Transaction{tx})
+	require.Nil(t, err)
+
+	added := (<-sub.Events()).(*BlockAddedEvent)
+	require.Equal(t, b, added.Block)
+	require.Len(t, added.Receipts, 1)
+
+	executed := (<-sub.Events()).(*TxExecutedEvent)
+	require.Equal(t, tx, executed.Transaction)
+	require.Equal(t, ReceiptSuccess, executed.Receipt.Status)
+	require.Equal(t, uint32(1), executed.Location.Height)
+
+	head := (<-sub.Events()).(*NewHeadEvent)
+	require.Equal(t, b.Header, head.Header)
+
+	// failed updates do not emit events
+	require.Equal(t, ErrBlockKnown, bc.AddBlock(b))
+	require.Len(t, sub.Events(), 0)
+}
+
+func TestSubscribeFilterAndBackpressure(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+	heads := bc.Subscribe(1, EventNewHead)
+
+	for i := 0; i < 3; i++ {
+		_, err := bc.CreateBlock(kp, nil)
+		require.Nil(t, err)
+	}
+
+	// buffer keeps the first head, later ones are dropped
+	head := (<-heads.Events()).(*NewHeadEvent)
+	require.Equal(t, uint32(1), head.Header.Height)
+	require.Equal(t, uint64(2), heads.Dropped())
+
+	heads.Unsubscribe()
+	_, ok := <-heads.Events()
+	require.False(t, ok)
+
+	_, err = bc.CreateBlock(kp, nil)
+	require.Nil(t, err)
+}
+
+func TestSubscribeLossless(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+	heads := bc.SubscribeLossless(EventNewHead)
+
+	// events are queued while the subscriber is behind
+	for i := 0; i < 32; i++ {
+		_, err := bc.CreateBlock(kp, nil)
+		require.Nil(t, err)
+	}
+	for height := uint32(1); height <= 32; height++ {
+		head := (<-heads.Events()).(*NewHeadEvent)
+		require.Equal(t, height, head.Header.Height)
+	}
+	require.Equal(t, uint64(0), heads.Dropped())
+
+	heads.Unsubscribe()
+	_, ok := <-heads.Events()
+	require.False(t, ok)
+}
+
+func TestSubscribeLosslessWhileSending(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 32; i++ {
+			if _, err := bc.CreateBlock(kp, nil); err != nil {
+				return
+			}
+		}
+	}()
+
+	// every head after subscribing is delivered, none is dropped
+	subs := []Subscription{}
+	for i := 0; i < 8; i++ {
+		subs = append(subs, bc.SubscribeLossless(EventNewHead))
+	}
+	<-done
+	require.Equal(t, uint32(32), bc.CurrentHeader().Height)
+
+	for _, sub := range subs {
+		last := uint32(0)
+		for last < 32 {
+			head := (<-sub.Events()).(*NewHeadEvent)
+			if last > 0 {
+				require.Equal(t, last+1, head.Header.Height)
+			}
+			last = head.Header.Height
+		}
+		require.Equal(t, uint64(0), sub.Dropped())
+		sub.Unsubscribe()
+	}
+}
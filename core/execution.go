@@ -0,0 +1,162 @@
+package core
+
+import (
+	"github.com/igumus/chainx/crypto"
+	"github.com/rs/zerolog/log"
+)
+
+// runTransactions executes block transactions one by one against given
+// state and returns their receipts.
+func (bc *chain) runTransactions(b *Block, state *State) ([]*Receipt, error) {
+	// block proposer collects transaction fees
+	producer := b.Header.Proposer
+	receipts := make([]*Receipt, 0, len(b.Transactions))
+	gasUsed := uint64(0)
+	for id, tx := range b.Transactions {
+		receipt, err := bc.applyTransaction(tx, state, producer)
+		if err != nil {
+			return nil, err
+		}
+		gasUsed += receipt.GasUsed
+		if gasUsed > bc.blockGasLimit {
+			return nil, ErrBlockGasLimitExceeded
+		}
+		receipts = append(receipts, receipt)
+
+		event := log.Info()
+		if receipt.Status == ReceiptFailed {
+			event = log.Warn().Str("error", receipt.Error)
+		}
+		event.
+			Uint32("height", b.Header.Height).
+			Str("txhash", tx.Hash().String()).
+			Int("txSeq", id).
+			Uint64("gasUsed", receipt.GasUsed).
+			Msg("executed transaction")
+	}
+	return receipts, nil
+}
+
+// verifyTransactionData checks the transaction type and statically
+// verifies bytecode of contract transactions, transactions failing it are
+// never included in blocks.
+func verifyTransactionData(tx *Transaction) error {
+	if tx.Type.isUnknown() {
+		return ErrTxTypeNotValid
+	}
+	if tx.Type != TxContract || len(tx.Data) == 0 {
+		return nil
+	}
+	return VerifyBytecode(tx.Data)
+}
+
+// applyTransaction checks chain id, gas limit, type, bytecode, sender nonce and balance,
+// then runs contract bytecode and moves transaction value. An error is
+// returned for transactions which can not be included in a block at all;
+// such a transaction leaves state untouched.
+//
+// Bytecode of a contract transaction without recipient runs in a new
+// contract at ContractAddress of the sender and nonce, which records the
+// sender as its creator; bytecode of other contract transactions runs in
+// the recipient contract, which fails unless the sender created it.
+//
+// Failing bytecode (e.g. running out of gas) does not make transaction
+// invalid: its state changes and value transfer are discarded, but the
+// sender nonce is increased and the fee for the used gas is moved to the
+// block producer.
+//
+// Every change is made on a state staged on top of the given state and
+// committed at once, so the given state is either fully updated or left
+// untouched. Returned receipt records the outcome of the transaction.
+func (bc *chain) applyTransaction(tx *Transaction, parent *State, producer crypto.Address) (*Receipt, error) {
+	state := parent.Stage()
+
+	if tx.ChainID != bc.id {
+		return nil, ErrTxChainIDNotValid
+	}
+	if tx.GasLimit < TxBaseGas {
+		return nil, ErrTxIntrinsicGas
+	}
+	if err := verifyTransactionData(tx); err != nil {
+		return nil, err
+	}
+
+	from := tx.From()
+	sender := state.GetAccount(from)
+	if tx.Nonce != sender.Nonce {
+		return nil, ErrTxNonceNotValid
+	}
+	cost, ok := maxTransactionCost(tx)
+	if !ok || sender.Balance < cost {
+		return nil, ErrInsufficientBalance
+	}
+
+	receipt := &Receipt{
+		TxHash:  tx.Hash(),
+		Status:  ReceiptSuccess,
+		GasUsed: TxBaseGas,
+		Writes:  [][]byte{},
+		Logs:    [][]byte{},
+	}
+	if tx.Type == TxContract && len(tx.Data) > 0 {
+		contract, created, err := contractAddress(tx, from, state)
+		if err == nil {
+			// failing bytecode reverts its own changes on the state
+			vm := NewVMWithGas(tx.Data, contract, state, tx.GasLimit-TxBaseGas)
+			err = vm.Run()
+			receipt.GasUsed += vm.GasUsed()
+			if err == nil {
+				receipt.Logs = vm.Logs()
+			}
+		}
+		if err == nil && created {
+			err = state.Put(contractCreatorKey(contract), from.Bytes())
+		}
+		if err != nil {
+			receipt.Status = ReceiptFailed
+			receipt.Code = receiptCode(err)
+			receipt.Error = err.Error()
+		}
+	}
+	succeeded := receipt.Status == ReceiptSuccess
+
+	// cannot overflow, since gas used is bounded by the gas limit
+	fee := receipt.GasUsed * tx.GasPrice
+
+	sender.Nonce++
+	sender.Balance -= fee
+	if succeeded {
+		sender.Balance -= tx.Value
+	}
+	if err := state.PutAccount(from, sender); err != nil {
+		return nil, err
+	}
+
+	if succeeded {
+		if tx.Value > 0 {
+			recipient := state.GetAccount(tx.To)
+			if err := recipient.credit(tx.Value); err != nil {
+				return nil, err
+			}
+			if err := state.PutAccount(tx.To, recipient); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if fee > 0 {
+		account := state.GetAccount(producer)
+		if err := account.credit(fee); err != nil {
+			return nil, err
+		}
+		if err := state.PutAccount(producer, account); err != nil {
+			return nil, err
+		}
+	}
+
+	receipt.Writes = state.changedKeys()
+	if err := state.Commit(); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"errors"
+	"math/bits"
+)
+
+const (
+	// gas charged for every transaction before executing its bytecode
+	TxBaseGas uint64 = 10
+	// gas limit of transactions created without an explicit one
+	DefaultTxGasLimit uint64 = 100_000
+	// total gas all transactions of a block can use
+	DefaultBlockGasLimit uint64 = 10_000_000
+	// gas limit of VMs created without an explicit one, the gas left for
+	// bytecode of a transaction with the default gas limit
+	defaultVMGas = DefaultTxGasLimit - TxBaseGas
+)
+
+var (
+	ErrOutOfGas              = errors.New("out of gas")
+	ErrTxIntrinsicGas        = errors.New("transaction gas limit below base gas")
+	ErrBlockGasLimitExceeded = errors.New("block gas limit exceeded")
+)
+
+// instructionGas is the cost of executing each instruction.
+var instructionGas = map[Instruction]uint64{
+	InstrPushInt:      1,
+	InstrPushByte:     1,
+	InstrStrCreate:    1,
+	InstrStrPack:      3,
+	InstrStore:        20,
+	InstrLoadState:    10,
+	InstrMultiply:     3,
+	InstrSub:          2,
+	InstrAdd:          2,
+	InstrLog:          5,
+	InstrLoadRange:    10,
+	InstrLoadExternal: 10,
+	InstrEq:           3,
+	InstrLt:           3,
+	InstrGt:           3,
+	InstrAnd:          2,
+	InstrOr:           2,
+	InstrNot:          2,
+	InstrJump:         8,
+	InstrJumpIf:       10,
+	InstrHalt:         0,
+}
+
+// gas charged for every entry loaded by InstrLoadRange
+const rangeEntryGas uint64 = 5
+
+// maxTransactionCost returns the amount sender must hold to submit the
+// transaction: value plus fee of the whole gas limit.
+func maxTransactionCost(tx *Transaction) (uint64, bool) {
+	hi, fee := bits.Mul64(tx.GasLimit, tx.GasPrice)
+	if hi != 0 {
+		return 0, false
+	}
+	cost, carry := bits.Add64(fee, tx.Value, 0)
+	return cost, carry == 0
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMOutOfGas(t *testing.T) {
+	contract := createStoreContract('a', 1)
+
+	vm := NewVMWithGas(contract, crypto.Address{}, NewState(), 10)
+	err := vm.Run()
+	require.Equal(t, ErrOutOfGas, err)
+	require.Equal(t, uint64(10), vm.GasUsed())
+
+	vm = NewVMWithGas(contract, crypto.Address{}, NewState(), 100)
+	err = vm.Run()
+	require.Nil(t, err)
+	// str create, push byte, str pack, push int, store
+	require.Equal(t, uint64(1+1+3+1+20), vm.GasUsed())
+}
+
+func createSignedContractTx(t *testing.T, kp *crypto.KeyPair, data []byte, nonce, gasLimit, gasPrice uint64) *Transaction {
+	tx := NewTransaction(data)
+	tx.Nonce = nonce
+	tx.GasLimit = gasLimit
+	tx.GasPrice = gasPrice
+	require.Nil(t, tx.Sign(kp))
+	return tx
+}
+
+func TestTransactionFees(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	producer, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithGenesisAlloc(sender.Address(), 1000))
+	require.Nil(t, err)
+
+	contract := createStoreContract('a', 1)
+	txs := []*Transaction{
+		createSignedContractTx(t, sender, contract, 0, 100, 2),
+		// runs out of gas, but still charged
+		createSignedContractTx(t, sender, contract, 1, 20, 2),
+	}
+	b, err := bc.CreateBlock(producer, txs)
+	require.Nil(t, err)
+	require.Len(t, b.Transactions, 2)
+
+	fee := (TxBaseGas+26)*2 + 20*2
+	account, err := bc.GetAccount(sender.Address())
+	require.Nil(t, err)
+	require.Equal(t, uint64(1000)-fee, account.Balance)
+	require.Equal(t, uint64(2), account.Nonce)
+
+	account, err = bc.GetAccount(producer.Address())
+	require.Nil(t, err)
+	require.Equal(t, fee, account.Balance)
+}
+
+func TestTransactionFeeExceedsBalance(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithGenesisAlloc(sender.Address(), 100))
+	require.Nil(t, err)
+
+	txpool, err := NewTXPool(WithChainReader(bc))
+	require.Nil(t, err)
+
+	tx := createSignedContractTx(t, sender, createStoreContract('a', 1), 0, 100, 2)
+	require.Equal(t, ErrInsufficientBalance, txpool.Add(tx))
+
+	tx = createSignedContractTx(t, sender, createStoreContract('a', 1), 0, TxBaseGas-1, 0)
+	require.Equal(t, ErrTxIntrinsicGas, txpool.Add(tx))
+}
+
+func TestBlockGasLimit(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithBlockGasLimit(120))
+	require.Nil(t, err)
+
+	contract := createStoreContract('a', 1)
+	txs := []*Transaction{
+		createSignedContractTx(t, kp, contract, 0, 100, 0),
+		createSignedContractTx(t, kp, contract, 1, 100, 0),
+	}
+	b, err := bc.CreateBlock(kp, txs)
+	require.Nil(t, err)
+	require.Len(t, b.Transactions, 1)
+
+	// block using more gas than allowed is rejected
+	other, err := NewBlockChain(WithBlockGasLimit(30))
+	require.Nil(t, err)
+	require.Equal(t, ErrBlockGasLimitExceeded, other.AddBlock(b))
+}
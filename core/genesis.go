@@ -0,0 +1,194 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/bits"
+	"os"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
+)
+
+var (
+	ErrGenesisHashAlgorithm = errors.New("hashes are not created with the genesis hash algorithm")
+	ErrGenesisStateNotValid = errors.New("genesis state entry is invalid")
+	ErrGenesisAllocOverflow = errors.New("genesis allocations overflow total supply")
+)
+
+// chain identity kept in contract state, so that it is committed by the
+// genesis state root
+var (
+	chainIDKey         = []byte("\x00chain/id")
+	chainValidatorsKey = []byte("\x00chain/validators")
+)
+
+// Genesis describes the initial state of a chain. Every node of a chain
+// must start from the same genesis, otherwise their genesis block hashes
+// differ.
+type Genesis struct {
+	ChainID       uint32                    `json:"chainId"`
+	HashAlgorithm hash.HashAlgorithm        `json:"hashAlgorithm"`
+	Timestamp     int64                     `json:"timestamp"`
+	Validators    []crypto.Address          `json:"validators"`
+	Alloc         map[crypto.Address]uint64 `json:"alloc"`
+	// initial contract state, hex encoded keys to hex encoded values
+	State map[string]string `json:"state"`
+}
+
+// DefaultGenesis returns genesis of a chain with default chain id and
+// hash algorithm, without validators, allocations or contract state.
+func DefaultGenesis() *Genesis {
+	return &Genesis{
+		ChainID:       DefaultChainID,
+		HashAlgorithm: hash.Sha2_256,
+		Timestamp:     0,
+		Validators:    []crypto.Address{},
+		Alloc:         make(map[crypto.Address]uint64),
+		State:         make(map[string]string),
+	}
+}
+
+// LoadGenesis reads genesis spec from given json file.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := DefaultGenesis()
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, err
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Validate checks that the genesis spec can be turned into a genesis
+// state.
+func (g *Genesis) Validate() error {
+	if _, err := g.HashAlgorithm.MarshalText(); err != nil {
+		return err
+	}
+	if _, err := g.decodeState(); err != nil {
+		return err
+	}
+	return g.validateAlloc()
+}
+
+// validateAlloc checks that allocated balances sum up to at most the
+// maximum balance. Transactions only move existing balance around, so
+// this bounds every balance of the chain.
+func (g *Genesis) validateAlloc() error {
+	total := uint64(0)
+	for _, balance := range g.Alloc {
+		sum, carry := bits.Add64(total, balance, 0)
+		if carry != 0 {
+			return ErrGenesisAllocOverflow
+		}
+		total = sum
+	}
+	return nil
+}
+
+func (g *Genesis) decodeState() (map[string][]byte, error) {
+	entries := make(map[string][]byte, len(g.State))
+	for k, v := range g.State {
+		key, err := hex.DecodeString(k)
+		if err != nil || len(key) == 0 || isReservedKey(key) {
+			return nil, ErrGenesisStateNotValid
+		}
+		value, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, ErrGenesisStateNotValid
+		}
+		entries[string(key)] = value
+	}
+	return entries, nil
+}
+
+// IsValidator reports whether given address may sign blocks. Any address
+// may sign blocks of a chain without validators.
+func (g *Genesis) IsValidator(addr crypto.Address) bool {
+	if len(g.Validators) == 0 {
+		return true
+	}
+	for _, v := range g.Validators {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// NewState creates initial state described by the genesis.
+func (g *Genesis) NewState() (*State, error) {
+	entries, err := g.decodeState()
+	if err != nil {
+		return nil, err
+	}
+	if err := g.validateAlloc(); err != nil {
+		return nil, err
+	}
+
+	state := NewState()
+	for k, v := range entries {
+		if err := state.Put([]byte(k), v); err != nil {
+			return nil, err
+		}
+	}
+	for addr, balance := range g.Alloc {
+		if err := state.PutAccount(addr, &Account{Balance: balance}); err != nil {
+			return nil, err
+		}
+	}
+
+	id := make([]byte, 4)
+	binary.LittleEndian.PutUint32(id, g.ChainID)
+	if err := state.Put(chainIDKey, id); err != nil {
+		return nil, err
+	}
+
+	validators := make([][]byte, len(g.Validators))
+	for i, v := range g.Validators {
+		validators[i] = v.Bytes()
+	}
+	if err := state.Put(chainValidatorsKey, bytes.Join(validators, []byte{})); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Block creates genesis block committing to the genesis state.
+func (g *Genesis) Block() (*Block, error) {
+	state, err := g.NewState()
+	if err != nil {
+		return nil, err
+	}
+	b, err := NewGenesisBlock(state)
+	if err != nil {
+		return nil, err
+	}
+	b.Header.Timestamp = g.Timestamp
+	return b, nil
+}
+
+func (g *Genesis) copy() *Genesis {
+	c := *g
+	c.Validators = append([]crypto.Address{}, g.Validators...)
+	c.Alloc = make(map[crypto.Address]uint64, len(g.Alloc))
+	for k, v := range g.Alloc {
+		c.Alloc[k] = v
+	}
+	c.State = make(map[string]string, len(g.State))
+	for k, v := range g.State {
+		c.State[k] = v
+	}
+	return &c
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGenesis(t *testing.T, spec string) string {
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	require.Nil(t, os.WriteFile(path, []byte(spec), 0600))
+	return path
+}
+
+func TestLoadGenesis(t *testing.T) {
+	key, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	path := writeGenesis(t, `{
+		"chainId": 7,
+		"hashAlgorithm": "sha2-256",
+		"timestamp": 1000,
+		"validators": ["`+key.Address().String()+`"],
+		"alloc": {"`+key.Address().String()+`": 100},
+		"state": {"666f6f": "03"}
+	}`)
+
+	g, err := LoadGenesis(path)
+	require.Nil(t, err)
+	require.Equal(t, uint32(7), g.ChainID)
+	require.Equal(t, hash.Sha2_256, g.HashAlgorithm)
+	require.True(t, g.IsValidator(key.Address()))
+	require.False(t, g.IsValidator(crypto.Address{}))
+
+	bc, err := NewBlockChain(WithGenesis(g))
+	require.Nil(t, err)
+	require.Equal(t, uint32(7), bc.ChainID())
+	require.Equal(t, int64(1000), bc.CurrentHeader().Timestamp)
+
+	account, err := bc.GetAccount(key.Address())
+	require.Nil(t, err)
+	require.Equal(t, uint64(100), account.Balance)
+
+	state, err := g.NewState()
+	require.Nil(t, err)
+	value, err := state.Get([]byte("foo"))
+	require.Nil(t, err)
+	require.Equal(t, []byte{0x03}, value)
+}
+
+func TestLoadGenesisNotValid(t *testing.T) {
+	_, err := LoadGenesis(writeGenesis(t, `{"hashAlgorithm": "md5"}`))
+	require.Equal(t, hash.ErrUnknownHashAlgorithm, err)
+
+	_, err = LoadGenesis(writeGenesis(t, `{"state": {"00666f6f": "03"}}`))
+	require.Equal(t, ErrGenesisStateNotValid, err)
+
+	_, err = LoadGenesis(writeGenesis(t, `{"alloc": {
+		"0101010101010101010101010101010101010101": 18446744073709551615,
+		"0202020202020202020202020202020202020202": 1
+	}}`))
+	require.Equal(t, ErrGenesisAllocOverflow, err)
+
+	_, err = LoadGenesis(writeGenesis(t, `{"alloc": {"abcd": 1}}`))
+	require.NotNil(t, err)
+}
+
+func TestGenesisHash(t *testing.T) {
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+
+	genesis, err := GenesisBlock()
+	require.Nil(t, err)
+	require.Equal(t, genesis.Header.Hash(), bc.GenesisHash())
+
+	other, err := NewBlockChain(WithChainID(7))
+	require.Nil(t, err)
+	require.NotEqual(t, bc.GenesisHash(), other.GenesisHash())
+
+	g := DefaultGenesis()
+	g.HashAlgorithm = hash.Sha2_512
+	_, err = NewBlockChain(WithGenesis(g))
+	require.Equal(t, ErrGenesisHashAlgorithm, err)
+
+	// chain follows the genesis spec once hashes are created with it
+	require.Nil(t, hash.SetDefaultAlgorithm(hash.Sha2_512))
+	defer hash.SetDefaultAlgorithm(hash.Sha2_256)
+	bc, err = NewBlockChain(WithGenesis(g))
+	require.Nil(t, err)
+	require.Equal(t, hash.Sha2_512, bc.GenesisHash().Algorithm())
+}
+
+func TestGenesisValidators(t *testing.T) {
+	validator, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	outsider, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	g := DefaultGenesis()
+	g.Validators = []crypto.Address{validator.Address()}
+
+	local, err := NewBlockChain(WithGenesis(g))
+	require.Nil(t, err)
+	remote, err := NewBlockChain(WithGenesis(g))
+	require.Nil(t, err)
+
+	b, err := NewBlock(remote.CurrentHeader(), nil)
+	require.Nil(t, err)
+	require.Nil(t, b.Sign(outsider))
+	require.Equal(t, ErrBlockSignerNotValid, local.AddBlock(b))
+
+	b, err = remote.CreateBlock(validator, nil)
+	require.Nil(t, err)
+	require.Nil(t, local.AddBlock(b))
+}
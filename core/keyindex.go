@@ -0,0 +1,97 @@
+package core
+
+// maximum number of levels of the key index skip list, enough for far
+// more keys than a state holds
+const keyIndexMaxLevel = 24
+
+// keyIndex is an ordered set of state keys kept next to the state data,
+// so key ranges can be iterated without visiting keys outside of them.
+// It is a skip list: insert, remove and seek take logarithmic time.
+type keyIndex struct {
+	head  keyIndexNode // sentinel before the first key
+	level int
+	seed  uint64
+}
+
+type keyIndexNode struct {
+	key  string
+	next []*keyIndexNode
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		head:  keyIndexNode{next: make([]*keyIndexNode, keyIndexMaxLevel)},
+		level: 1,
+		seed:  0x9e3779b97f4a7c15,
+	}
+}
+
+// randomLevel picks the level of a new node, every level is half as
+// likely as the one below. Levels only affect performance, so a simple
+// xorshift generator is enough.
+func (ix *keyIndex) randomLevel() int {
+	ix.seed ^= ix.seed << 13
+	ix.seed ^= ix.seed >> 7
+	ix.seed ^= ix.seed << 17
+	level := 1
+	for r := ix.seed; level < keyIndexMaxLevel && r&1 == 1; r >>= 1 {
+		level++
+	}
+	return level
+}
+
+// path returns the last node before key on every level.
+func (ix *keyIndex) path(key string) []*keyIndexNode {
+	path := make([]*keyIndexNode, keyIndexMaxLevel)
+	n := &ix.head
+	for l := ix.level - 1; l >= 0; l-- {
+		for n.next[l] != nil && n.next[l].key < key {
+			n = n.next[l]
+		}
+		path[l] = n
+	}
+	return path
+}
+
+func (ix *keyIndex) insert(key string) {
+	path := ix.path(key)
+	if n := path[0].next[0]; n != nil && n.key == key {
+		return
+	}
+
+	level := ix.randomLevel()
+	for l := ix.level; l < level; l++ {
+		path[l] = &ix.head
+	}
+	if level > ix.level {
+		ix.level = level
+	}
+
+	node := &keyIndexNode{key: key, next: make([]*keyIndexNode, level)}
+	for l := 0; l < level; l++ {
+		node.next[l] = path[l].next[l]
+		path[l].next[l] = node
+	}
+}
+
+func (ix *keyIndex) remove(key string) {
+	path := ix.path(key)
+	node := path[0].next[0]
+	if node == nil || node.key != key {
+		return
+	}
+	for l := 0; l < len(node.next); l++ {
+		path[l].next[l] = node.next[l]
+	}
+}
+
+// seek returns the node of the first key not less than given key, or nil.
+func (ix *keyIndex) seek(key string) *keyIndexNode {
+	n := &ix.head
+	for l := ix.level - 1; l >= 0; l-- {
+		for n.next[l] != nil && n.next[l].key < key {
+			n = n.next[l]
+		}
+	}
+	return n.next[0]
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"time"
+
+	"github.com/igumus/chainx/crypto"
+)
+
+// how far block timestamps may be ahead of local clock by default
+const DefaultMaxTimestampDrift = 15 * time.Second
+
+// number of latest blocks whose state is kept for queries by default
+const DefaultStateRetention = 128
+
+// create chain options
+type ChainOption func(*chainOptions)
+
+type chainOptions struct {
+	// block storage, defaults to in-memory storage
+	storage Storage
+	// genesis spec of the chain, defaults to DefaultGenesis
+	genesis *Genesis
+	// total gas transactions of a block can use
+	blockGasLimit uint64
+	// how far block timestamps may be ahead of local clock
+	maxTimestampDrift time.Duration
+	// number of latest blocks whose state is kept, zero keeps every block
+	stateRetention uint32
+}
+
+func createOptions(opts ...ChainOption) *chainOptions {
+	cfg := &chainOptions{
+		storage:           nil,
+		genesis:           DefaultGenesis(),
+		blockGasLimit:     DefaultBlockGasLimit,
+		maxTimestampDrift: DefaultMaxTimestampDrift,
+		stateRetention:    DefaultStateRetention,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.storage == nil {
+		cfg.storage = NewMemoryStorage()
+	}
+
+	return cfg
+}
+
+func WithStorage(s Storage) ChainOption {
+	return func(co *chainOptions) {
+		co.storage = s
+	}
+}
+
+// WithGenesis sets genesis spec of the chain. Options changing genesis
+// fields (e.g. WithChainID) should be given after it.
+func WithGenesis(g *Genesis) ChainOption {
+	return func(co *chainOptions) {
+		co.genesis = g.copy()
+	}
+}
+
+func WithChainID(id uint32) ChainOption {
+	return func(co *chainOptions) {
+		co.genesis.ChainID = id
+	}
+}
+
+func WithBlockGasLimit(limit uint64) ChainOption {
+	return func(co *chainOptions) {
+		co.blockGasLimit = limit
+	}
+}
+
+func WithMaxTimestampDrift(d time.Duration) ChainOption {
+	return func(co *chainOptions) {
+		co.maxTimestampDrift = d
+	}
+}
+
+// WithStateRetention sets number of latest blocks whose state can be
+// queried with GetStateAt, zero keeps state of every block.
+func WithStateRetention(blocks uint32) ChainOption {
+	return func(co *chainOptions) {
+		co.stateRetention = blocks
+	}
+}
+
+func WithGenesisAlloc(addr crypto.Address, balance uint64) ChainOption {
+	return func(co *chainOptions) {
+		if co.genesis.Alloc == nil {
+			co.genesis.Alloc = make(map[crypto.Address]uint64)
+		}
+		co.genesis.Alloc[addr] = balance
+	}
+}
+
+// create transaction pool options
+type TXPoolOption func(*txPoolOptions)
+
+type txPoolOptions struct {
+	// chain used to validate chain id, nonce and balance of transactions,
+	// such checks are skipped if not specified
+	chain ChainReader
+}
+
+func createTXPoolOptions(opts ...TXPoolOption) *txPoolOptions {
+	cfg := &txPoolOptions{
+		chain: nil,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func WithChainReader(r ChainReader) TXPoolOption {
+	return func(to *txPoolOptions) {
+		to.chain = r
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/igumus/chainx/hash"
+)
+
+type ReceiptStatus byte
+
+const (
+	// bytecode failed, only nonce and fee changes are applied
+	ReceiptFailed ReceiptStatus = 0x0
+	// every change of the transaction is applied
+	ReceiptSuccess ReceiptStatus = 0x1
+)
+
+// ReceiptCode identifies the execution error of a failed transaction.
+// Codes are committed by the receipts root, so existing codes must never
+// change; new errors get new codes.
+type ReceiptCode byte
+
+const (
+	// transaction succeeded
+	ReceiptCodeNone ReceiptCode = 0x0
+	// error without a code of its own
+	ReceiptCodeOther                   ReceiptCode = 0x1
+	ReceiptCodeOutOfGas                ReceiptCode = 0x2
+	ReceiptCodeBytecodeEmpty           ReceiptCode = 0x3
+	ReceiptCodeInstructionUnknown      ReceiptCode = 0x4
+	ReceiptCodeOperandMissing          ReceiptCode = 0x5
+	ReceiptCodeJumpTargetNotValid      ReceiptCode = 0x6
+	ReceiptCodeStackUnderflow          ReceiptCode = 0x7
+	ReceiptCodeStackOverflow           ReceiptCode = 0x8
+	ReceiptCodeOperandType             ReceiptCode = 0x9
+	ReceiptCodeContractAddressNotValid ReceiptCode = 0xa
+	ReceiptCodeStateKeyNotFound        ReceiptCode = 0xb
+	ReceiptCodeReservedStateKey        ReceiptCode = 0xc
+)
+
+var receiptCodes = []struct {
+	err  error
+	code ReceiptCode
+}{
+	{ErrOutOfGas, ReceiptCodeOutOfGas},
+	{ErrBytecodeEmpty, ReceiptCodeBytecodeEmpty},
+	{ErrInstructionUnknown, ReceiptCodeInstructionUnknown},
+	{ErrOperandMissing, ReceiptCodeOperandMissing},
+	{ErrJumpTargetNotValid, ReceiptCodeJumpTargetNotValid},
+	{ErrStackUnderflow, ReceiptCodeStackUnderflow},
+	{ErrStackOverflow, ReceiptCodeStackOverflow},
+	{ErrOperandType, ReceiptCodeOperandType},
+	{ErrContractAddressNotValid, ReceiptCodeContractAddressNotValid},
+	{ErrStateKeyNotFound, ReceiptCodeStateKeyNotFound},
+	{ErrReservedStateKey, ReceiptCodeReservedStateKey},
+}
+
+// receiptCode returns the code of given execution error.
+func receiptCode(err error) ReceiptCode {
+	if err == nil {
+		return ReceiptCodeNone
+	}
+	for _, c := range receiptCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ReceiptCodeOther
+}
+
+// Receipt records the outcome of a transaction included in a block.
+type Receipt struct {
+	TxHash  hash.Hash
+	Status  ReceiptStatus
+	Code    ReceiptCode // execution error code of failed transactions
+	Error   string      // execution error message, not committed by the receipts root
+	GasUsed uint64      // gas used including base gas
+	Writes  [][]byte    // state keys written by the transaction, in key order
+	Logs    [][]byte    // data emitted by InstrLog, in emit order
+}
+
+// Bytes returns canonical encoding of the receipt, which leaves out the
+// error message.
+func (r *Receipt) Bytes() []byte {
+	w := &canonicalWriter{}
+	w.receipt(r)
+	return w.buf.Bytes()
+}
+
+func (r *Receipt) Hash() hash.Hash {
+	return hash.CreateHash(r.Bytes())
+}
+
+// calculateReceiptsHash returns the merkle root of receipt hashes.
+func calculateReceiptsHash(receipts []*Receipt) hash.Hash {
+	leaves := make([]hash.Hash, len(receipts))
+	for i, r := range receipts {
+		leaves[i] = r.Hash()
+	}
+	return hash.MerkleRoot(leaves)
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceipts(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	storage, err := NewFileStorage(t.TempDir())
+	require.Nil(t, err)
+	defer storage.Close()
+
+	bc, err := NewBlockChain(WithStorage(storage))
+	require.Nil(t, err)
+
+	logContract := append(createStoreContract('a', 1), 0x07, byte(InstrPushInt), byte(InstrLog))
+	succeeded := createSignedContractTx(t, kp, logContract, 0, DefaultTxGasLimit, 0)
+	failed := createSignedContractTx(t, kp, createStoreContract('b', 2), 1, TxBaseGas+1, 0)
+
+	b, err := bc.CreateBlock(kp, []*Transaction{succeeded, failed})
+	require.Nil(t, err)
+	require.Len(t, b.Transactions, 2)
+
+	receipts, err := bc.GetReceipts(b.Header.Hash())
+	require.Nil(t, err)
+	require.Len(t, receipts, 2)
+	require.Equal(t, calculateReceiptsHash(receipts), b.Header.ReceiptsRoot)
+
+	receipt, err := bc.GetReceipt(succeeded.Hash())
+	require.Nil(t, err)
+	require.Equal(t, ReceiptSuccess, receipt.Status)
+	require.Equal(t, succeeded.Hash(), receipt.TxHash)
+	require.Empty(t, receipt.Error)
+	require.Equal(t, ReceiptCodeNone, receipt.Code)
+	require.Contains(t, receipt.Writes, ContractKey(createdContract(succeeded), []byte("a")))
+	require.Contains(t, receipt.Writes, accountKey(kp.Address()))
+	require.Contains(t, receipt.Writes, contractCreatorKey(createdContract(succeeded)))
+
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, 7)
+	require.Equal(t, [][]byte{value}, receipt.Logs)
+
+	receipt, err = bc.GetReceipt(failed.Hash())
+	require.Nil(t, err)
+	require.Equal(t, ReceiptFailed, receipt.Status)
+	require.Equal(t, ErrOutOfGas.Error(), receipt.Error)
+	require.Equal(t, ReceiptCodeOutOfGas, receipt.Code)
+	require.Equal(t, TxBaseGas+1, receipt.GasUsed)
+	require.Equal(t, [][]byte{accountKey(kp.Address())}, receipt.Writes)
+	require.Empty(t, receipt.Logs)
+}
+
+func TestReceiptHashCommitsCode(t *testing.T) {
+	receipt := &Receipt{
+		Status: ReceiptFailed,
+		Code:   receiptCode(fmt.Errorf("%w: foo", ErrStateKeyNotFound)),
+		Error:  "key not found in state: foo",
+	}
+	require.Equal(t, ReceiptCodeStateKeyNotFound, receipt.Code)
+
+	// rewording an error message does not change the receipt hash
+	reworded := *receipt
+	reworded.Error = "no such key: foo"
+	require.Equal(t, receipt.Hash(), reworded.Hash())
+
+	other := *receipt
+	other.Code = ReceiptCodeOther
+	require.NotEqual(t, receipt.Hash(), other.Hash())
+}
+
+func TestReceiptsRootNotValid(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	local, err := NewBlockChain()
+	require.Nil(t, err)
+	remote, err := NewBlockChain()
+	require.Nil(t, err)
+
+	b, err := remote.CreateBlock(kp, []*Transaction{
+		createSignedTransaction(t, createStoreContract('a', 1)),
+	})
+	require.Nil(t, err)
+
+	b.Header.ReceiptsRoot = calculateReceiptsHash(nil)
+	require.Nil(t, b.Sign(kp))
+	require.Equal(t, ErrBlockReceiptsRootNotValid, local.AddBlock(b))
+}
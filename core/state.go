@@ -1,38 +1,358 @@
 package core
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
 
+	"github.com/igumus/chainx/hash"
+)
+
+var (
+	ErrStateNotStaged       = errors.New("state is not staged on a parent state")
+	ErrStateSnapshotUnknown = errors.New("state snapshot is unknown")
+	ErrStateKeyNotFound     = errors.New("key not found in state")
+)
+
+// State is a key/value store of contract values and accounts. A state
+// can be staged on top of a parent state: reads fall through to the
+// parent, while writes and deletes are kept locally until Commit.
+// Content of the state is committed by a sparse merkle tree, which is
+// updated along with every write and provides the state root and
+// proofs of keys.
+//
+// Changes made after a snapshot are journaled, so they can be reverted
+// with RevertTo. Snapshots are nested: reverting to a snapshot also
+// reverts (and forgets) every snapshot taken after it.
 type State struct {
-	data map[string][]byte
+	parent    *State
+	data      map[string][]byte
+	deleted   map[string]struct{}
+	index     *keyIndex // keys of data and deleted, in order
+	trie      *trieNode
+	journal   []journalEntry
+	snapshots []snapshot
+	nextID    int
+}
+
+// journalEntry records a key of the state as it was before a change.
+type journalEntry struct {
+	key     string
+	value   []byte
+	written bool // key was in data
+	deleted bool // key was in deleted
+}
+
+type snapshot struct {
+	id      int
+	journal int // journal length when the snapshot was taken
+	trie    *trieNode
 }
 
 func NewState() *State {
 	return &State{
-		data: make(map[string][]byte),
+		data:    make(map[string][]byte),
+		deleted: make(map[string]struct{}),
+		index:   newKeyIndex(),
+	}
+}
+
+// Stage creates an empty state on top of this state. Changes on the
+// staged state are applied to this state only when committed; dropping
+// the staged state discards them. This state must not be modified while
+// the staged state is in use.
+func (s *State) Stage() *State {
+	staged := NewState()
+	staged.parent = s
+	staged.trie = s.trie
+	return staged
+}
+
+// Commit applies changes of a staged state to its parent and resets
+// the staged state.
+func (s *State) Commit() error {
+	if s.parent == nil {
+		return ErrStateNotStaged
+	}
+	for k := range s.deleted {
+		if err := s.parent.Delete([]byte(k)); err != nil {
+			return err
+		}
 	}
+	for k, v := range s.data {
+		if err := s.parent.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	s.data = make(map[string][]byte)
+	s.deleted = make(map[string]struct{})
+	s.index = newKeyIndex()
+	s.trie = s.parent.trie
+	s.journal = nil
+	s.snapshots = nil
+	return nil
+}
+
+// Snapshot returns id of a snapshot of the current content, which can be
+// restored with RevertTo. Snapshots of a staged state are dropped when
+// it is committed.
+func (s *State) Snapshot() int {
+	s.nextID++
+	s.snapshots = append(s.snapshots, snapshot{
+		id:      s.nextID,
+		journal: len(s.journal),
+		trie:    s.trie,
+	})
+	return s.nextID
+}
+
+// RevertTo undoes every change made after the snapshot with given id.
+func (s *State) RevertTo(id int) error {
+	idx := -1
+	for i, snap := range s.snapshots {
+		if snap.id == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return ErrStateSnapshotUnknown
+	}
+
+	snap := s.snapshots[idx]
+	for i := len(s.journal) - 1; i >= snap.journal; i-- {
+		e := s.journal[i]
+		if e.written {
+			s.data[e.key] = e.value
+		} else {
+			delete(s.data, e.key)
+		}
+		if e.deleted {
+			s.deleted[e.key] = struct{}{}
+		} else {
+			delete(s.deleted, e.key)
+		}
+		if e.written || e.deleted {
+			s.index.insert(e.key)
+		} else {
+			s.index.remove(e.key)
+		}
+	}
+	s.journal = s.journal[:snap.journal]
+	s.snapshots = s.snapshots[:idx]
+	s.trie = snap.trie
+	return nil
+}
+
+// record journals the key before a change, while there are snapshots to
+// revert to.
+func (s *State) record(key string) {
+	if len(s.snapshots) == 0 {
+		return
+	}
+	value, written := s.data[key]
+	_, deleted := s.deleted[key]
+	s.journal = append(s.journal, journalEntry{
+		key:     key,
+		value:   value,
+		written: written,
+		deleted: deleted,
+	})
 }
 
 func (s *State) Put(k, v []byte) error {
-	s.data[string(k)] = v
+	key := string(k)
+	s.record(key)
+	s.data[key] = v
+	delete(s.deleted, key)
+	s.index.insert(key)
+	s.trie = triePut(s.trie, k, v)
 	return nil
 }
 
 func (s *State) Delete(k []byte) error {
-	delete(s.data, string(k))
+	key := string(k)
+	s.record(key)
+	delete(s.data, key)
+	if s.parent != nil {
+		s.deleted[key] = struct{}{}
+		s.index.insert(key)
+	} else {
+		s.index.remove(key)
+	}
+	s.trie = trieRemove(s.trie, k)
 	return nil
 }
 
+func (s *State) lookup(key string) ([]byte, bool) {
+	if v, ok := s.data[key]; ok {
+		return v, true
+	}
+	if _, ok := s.deleted[key]; ok {
+		return nil, false
+	}
+	if s.parent != nil {
+		return s.parent.lookup(key)
+	}
+	return nil, false
+}
+
 func (s *State) Get(k []byte) ([]byte, error) {
 	key := string(k)
-	v, ok := s.data[key]
+	v, ok := s.lookup(key)
 	if !ok {
-		return nil, fmt.Errorf("key not found in state: %s", key)
+		return nil, fmt.Errorf("%w: %s", ErrStateKeyNotFound, key)
 	}
 	return v, nil
 }
 
+// changedKeys returns keys written or deleted on this state (not on its
+// parents), in key order.
+func (s *State) changedKeys() [][]byte {
+	result := make([][]byte, 0, len(s.data)+len(s.deleted))
+	for n := s.index.seek(""); n != nil; n = n.next[0] {
+		result = append(result, []byte(n.key))
+	}
+	return result
+}
+
+// stateUndo records the value a key had before a change, so the change
+// can be undone.
+type stateUndo struct {
+	key    string
+	value  []byte
+	exists bool
+}
+
+// undoLog returns the values which keys changed on this staged state
+// have on its parent.
+func (s *State) undoLog() []stateUndo {
+	keys := s.changedKeys()
+	undo := make([]stateUndo, len(keys))
+	for i, k := range keys {
+		v, ok := s.parent.lookup(string(k))
+		undo[i] = stateUndo{key: string(k), value: v, exists: ok}
+	}
+	return undo
+}
+
+// undo restores keys to the values recorded in given undo log.
+func (s *State) undo(log []stateUndo) {
+	for _, u := range log {
+		if u.exists {
+			s.Put([]byte(u.key), u.value)
+		} else {
+			s.Delete([]byte(u.key))
+		}
+	}
+}
+
+// Merge applies writes and deletes made on other state to this state.
 func (s *State) Merge(other *State) {
-	for otk, otv := range other.data {
-		s.data[otk] = otv
+	for k := range other.deleted {
+		s.Delete([]byte(k))
+	}
+	for k, v := range other.data {
+		s.Put([]byte(k), v)
+	}
+}
+
+// Iterate calls fn for every key in range [start, end) in key order,
+// until fn returns false. Nil start or end leaves the range open on that
+// side. Only keys within the range are visited: the ordered key indexes
+// of the state and its parents are walked together, and the topmost state
+// holding a key decides its value. State must not be modified by fn.
+func (s *State) Iterate(start, end []byte, fn func(k, v []byte) bool) {
+	layers := []*State{}
+	cursors := []*keyIndexNode{}
+	for l := s; l != nil; l = l.parent {
+		layers = append(layers, l)
+		cursors = append(cursors, l.index.seek(string(start)))
+	}
+
+	for {
+		top := -1
+		for i, c := range cursors {
+			if c != nil && (top < 0 || c.key < cursors[top].key) {
+				top = i
+			}
+		}
+		if top < 0 {
+			return
+		}
+		key := cursors[top].key
+		if end != nil && key >= string(end) {
+			return
+		}
+
+		value, ok := layers[top].data[key]
+		for i, c := range cursors {
+			if c != nil && c.key == key {
+				cursors[i] = c.next[0]
+			}
+		}
+		if ok && !fn([]byte(key), value) {
+			return
+		}
 	}
 }
+
+// IteratePrefix calls fn for every key with given prefix in key order,
+// until fn returns false.
+func (s *State) IteratePrefix(prefix []byte, fn func(k, v []byte) bool) {
+	start, end := prefixRange(prefix)
+	s.Iterate(start, end, fn)
+}
+
+// prefixRange returns the key range holding every key with given prefix.
+// End is nil when there is no upper bound (e.g. prefix of 0xff bytes).
+func prefixRange(prefix []byte) ([]byte, []byte) {
+	start := append([]byte{}, prefix...)
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			end := append([]byte{}, prefix[:i+1]...)
+			end[i]++
+			return start, end
+		}
+	}
+	return start, nil
+}
+
+// flatten returns every visible key/value pair of the state, including
+// the ones inherited from parent states.
+func (s *State) flatten() map[string][]byte {
+	result := make(map[string][]byte)
+	if s.parent != nil {
+		result = s.parent.flatten()
+	}
+	for k := range s.deleted {
+		delete(result, k)
+	}
+	for k, v := range s.data {
+		result[k] = v
+	}
+	return result
+}
+
+// Copy returns an independent copy of the state, changes on the copy
+// are not reflected to the original state.
+func (s *State) Copy() *State {
+	other := NewState()
+	other.data = s.flatten()
+	for k := range other.data {
+		other.index.insert(k)
+	}
+	other.trie = s.trie
+	return other
+}
+
+// Root returns the root of the sparse merkle tree committing the state
+// content. Root of an empty state is ZeroHash.
+func (s *State) Root() hash.Hash {
+	return trieNodeHash(s.trie)
+}
+
+// Prove creates a proof of the value of given key, or of its absence,
+// against the root of the state.
+func (s *State) Prove(k []byte) *StateProof {
+	return trieProve(s.trie, k)
+}
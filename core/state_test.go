@@ -0,0 +1,244 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateRoot(t *testing.T) {
+	require.True(t, NewState().Root().IsZero())
+
+	a := NewState()
+	a.Put([]byte("foo"), []byte{1})
+	a.Put([]byte("bar"), []byte{2})
+
+	b := NewState()
+	b.Put([]byte("bar"), []byte{2})
+	b.Put([]byte("foo"), []byte{1})
+
+	require.Equal(t, a.Root(), b.Root())
+
+	b.Put([]byte("foo"), []byte{3})
+	require.NotEqual(t, a.Root(), b.Root())
+
+	// key/value boundary is part of the commitment
+	c := NewState()
+	c.Put([]byte("fo"), []byte("o\x01"))
+	d := NewState()
+	d.Put([]byte("foo"), []byte{1})
+	require.NotEqual(t, c.Root(), d.Root())
+}
+
+func TestStateCopy(t *testing.T) {
+	s := NewState()
+	s.Put([]byte("foo"), []byte{1})
+
+	c := s.Copy()
+	c.Put([]byte("foo"), []byte{2})
+	c.Put([]byte("bar"), []byte{3})
+
+	v, err := s.Get([]byte("foo"))
+	require.Nil(t, err)
+	require.Equal(t, []byte{1}, v)
+	_, err = s.Get([]byte("bar"))
+	require.NotNil(t, err)
+}
+
+func TestStateStage(t *testing.T) {
+	s := NewState()
+	s.Put([]byte("foo"), []byte{1})
+	s.Put([]byte("bar"), []byte{2})
+
+	staged := s.Stage()
+	v, err := staged.Get([]byte("foo"))
+	require.Nil(t, err)
+	require.Equal(t, []byte{1}, v)
+
+	staged.Put([]byte("foo"), []byte{3})
+	staged.Delete([]byte("bar"))
+	staged.Put([]byte("baz"), []byte{4})
+
+	_, err = staged.Get([]byte("bar"))
+	require.NotNil(t, err)
+
+	// parent is untouched until commit
+	v, err = s.Get([]byte("foo"))
+	require.Nil(t, err)
+	require.Equal(t, []byte{1}, v)
+	_, err = s.Get([]byte("baz"))
+	require.NotNil(t, err)
+
+	expected := NewState()
+	expected.Put([]byte("foo"), []byte{3})
+	expected.Put([]byte("baz"), []byte{4})
+	require.Equal(t, expected.Root(), staged.Root())
+
+	require.Nil(t, staged.Commit())
+	require.Equal(t, expected.Root(), s.Root())
+	_, err = s.Get([]byte("bar"))
+	require.NotNil(t, err)
+
+	require.Equal(t, ErrStateNotStaged, s.Commit())
+}
+
+func TestStateSnapshot(t *testing.T) {
+	s := NewState()
+	s.Put([]byte("foo"), []byte{1})
+	staged := s.Stage()
+	staged.Put([]byte("bar"), []byte{2})
+	root := staged.Root()
+
+	outer := staged.Snapshot()
+	staged.Put([]byte("foo"), []byte{3})
+	staged.Delete([]byte("bar"))
+
+	inner := staged.Snapshot()
+	staged.Put([]byte("baz"), []byte{4})
+	require.Nil(t, staged.RevertTo(inner))
+	_, err := staged.Get([]byte("baz"))
+	require.NotNil(t, err)
+	v, err := staged.Get([]byte("foo"))
+	require.Nil(t, err)
+	require.Equal(t, []byte{3}, v)
+
+	// reverting to the outer snapshot forgets the inner one
+	inner = staged.Snapshot()
+	require.Nil(t, staged.RevertTo(outer))
+	require.Equal(t, ErrStateSnapshotUnknown, staged.RevertTo(inner))
+	require.Equal(t, root, staged.Root())
+	v, err = staged.Get([]byte("bar"))
+	require.Nil(t, err)
+	require.Equal(t, []byte{2}, v)
+	require.Equal(t, [][]byte{[]byte("bar")}, staged.changedKeys())
+
+	snap := staged.Snapshot()
+	require.Nil(t, staged.Commit())
+	require.Equal(t, ErrStateSnapshotUnknown, staged.RevertTo(snap))
+	require.Equal(t, root, s.Root())
+}
+
+func TestVMRevertsFailedRun(t *testing.T) {
+	state := NewState()
+	// runs out of gas after storing the value
+	contract := append(createStoreContract('a', 1), 0x01, byte(InstrPushInt), byte(InstrLog))
+
+	require.Equal(t, ErrOutOfGas, NewVMWithGas(contract, crypto.Address{}, state, 30).Run())
+	_, err := state.Get([]byte("a"))
+	require.NotNil(t, err)
+	require.True(t, state.Root().IsZero())
+}
+
+func TestStateIterate(t *testing.T) {
+	s := NewState()
+	s.Put([]byte("a"), []byte{1})
+	s.Put([]byte("ab"), []byte{2})
+	s.Put([]byte("b"), []byte{3})
+	s.Put([]byte("c"), []byte{4})
+
+	staged := s.Stage()
+	staged.Delete([]byte("b"))
+	staged.Put([]byte("bb"), []byte{5})
+
+	collect := func(iterate func(fn func(k, v []byte) bool)) []string {
+		keys := []string{}
+		iterate(func(k, v []byte) bool {
+			keys = append(keys, string(k))
+			return true
+		})
+		return keys
+	}
+
+	require.Equal(t, []string{"a", "ab", "bb", "c"}, collect(func(fn func(k, v []byte) bool) {
+		staged.Iterate(nil, nil, fn)
+	}))
+	require.Equal(t, []string{"ab", "bb"}, collect(func(fn func(k, v []byte) bool) {
+		staged.Iterate([]byte("aa"), []byte("c"), fn)
+	}))
+	require.Equal(t, []string{"a", "ab"}, collect(func(fn func(k, v []byte) bool) {
+		staged.IteratePrefix([]byte("a"), fn)
+	}))
+
+	// iteration stops once fn returns false
+	count := 0
+	staged.Iterate(nil, nil, func(k, v []byte) bool {
+		count++
+		return false
+	})
+	require.Equal(t, 1, count)
+
+	start, end := prefixRange([]byte{0x01, 0xff})
+	require.Equal(t, []byte{0x01, 0xff}, start)
+	require.Equal(t, []byte{0x02}, end)
+	_, end = prefixRange([]byte{0xff})
+	require.Nil(t, end)
+}
+
+func TestStateIterateIndex(t *testing.T) {
+	keys := func(s *State, start, end string) []string {
+		var to []byte
+		if end != "" {
+			to = []byte(end)
+		}
+		result := []string{}
+		s.Iterate([]byte(start), to, func(k, v []byte) bool {
+			result = append(result, string(k))
+			return true
+		})
+		return result
+	}
+
+	s := NewState()
+	for i := 0; i < 1000; i++ {
+		s.Put([]byte(fmt.Sprintf("k%04d", i)), []byte{1})
+	}
+	s.Delete([]byte("k0101"))
+	require.Equal(t, []string{"k0100", "k0102"}, keys(s, "k0100", "k0103"))
+
+	staged := s.Stage()
+	snap := staged.Snapshot()
+	staged.Put([]byte("k0100a"), []byte{2})
+	staged.Delete([]byte("k0102"))
+	require.Equal(t, []string{"k0100", "k0100a"}, keys(staged, "k0100", "k0103"))
+
+	// reverted changes leave the index too
+	require.NoError(t, staged.RevertTo(snap))
+	require.Equal(t, []string{"k0100", "k0102"}, keys(staged, "k0100", "k0103"))
+
+	staged.Put([]byte("k0101"), []byte{3})
+	require.NoError(t, staged.Commit())
+	require.Equal(t, []string{"k0100", "k0101", "k0102"}, keys(s, "k0100", "k0103"))
+	require.Empty(t, staged.changedKeys())
+	require.Len(t, keys(s.Copy(), "", ""), 1000)
+}
+
+func TestVMInstrLoadRange(t *testing.T) {
+	addr := crypto.Address{1}
+	state := NewState()
+	state.Put(ContractKey(addr, []byte("a")), []byte{1})
+	state.Put(ContractKey(addr, []byte("b")), []byte{2})
+	state.Put(ContractKey(addr, []byte("c")), []byte{3})
+	// values of other contracts are out of range
+	state.Put(ContractKey(crypto.Address{2}, []byte("a")), []byte{4})
+
+	contract := []byte{
+		0x00, byte(InstrStrCreate), byte(InstrStrPack),
+		// empty start key
+		0x00, byte(InstrStrCreate), byte(InstrStrPack),
+		// empty end key leaves the range open
+		0x02, byte(InstrLoadRange),
+	}
+
+	vm := NewVM(contract, addr, state)
+	require.Nil(t, vm.Run())
+	require.Equal(t, uint64(2), vm.stack.pop())
+	require.Equal(t, []byte{2}, vm.stack.pop())
+	require.Equal(t, []byte("b"), vm.stack.pop())
+	require.Equal(t, []byte{1}, vm.stack.pop())
+	require.Equal(t, []byte("a"), vm.stack.pop())
+	require.Equal(t, 0, vm.stack.sp)
+	// two strings, two entries
+	require.Equal(t, uint64(2*(1+3)+10+2*rangeEntryGas), vm.GasUsed())
+}
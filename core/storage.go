@@ -2,31 +2,54 @@ package core
 
 import (
 	"errors"
+	"io"
 	"sync"
+
+	"github.com/igumus/chainx/hash"
+)
+
+var (
+	ErrBlockNotFound         = errors.New("block not found in storage")
+	ErrStorageHeightMismatch = errors.New("block height does not match storage height")
+	ErrStorageReadOnly       = errors.New("storage is read only")
 )
 
+// Storage keeps canonical blocks together with receipts of their
+// transactions.
 type Storage interface {
-	Put(*Block) error
+	Put(*Block, []*Receipt) error
 	Get(height uint32) (*Block, error)
+	GetReceipts(height uint32) ([]*Receipt, error)
+	GetByHash(hash.Hash) (*Block, error)
 	GetAll(uint32, uint32) ([]*Block, error)
+	Rewind(height uint32) error
+	Size() int
+	io.Closer
 }
 
 type memoryStorage struct {
-	lock    sync.RWMutex
-	headers []*Header
-	blocks  []*Block
+	lock     sync.RWMutex
+	headers  []*Header
+	blocks   []*Block
+	receipts [][]*Receipt
+	lookup   map[string]uint32 // block hash to height
 }
 
 func NewMemoryStorage() Storage {
 	return &memoryStorage{
-		headers: []*Header{},
-		blocks:  []*Block{},
+		headers:  []*Header{},
+		blocks:   []*Block{},
+		receipts: [][]*Receipt{},
+		lookup:   make(map[string]uint32),
 	}
 }
 
 func (ms *memoryStorage) GetAll(from uint32, to uint32) ([]*Block, error) {
 	ms.lock.RLock()
 	defer ms.lock.RUnlock()
+	if int(to) >= len(ms.blocks) {
+		return nil, ErrBlockNotFound
+	}
 	result := []*Block{}
 	for i := from; i < to+1; i++ {
 		result = append(result, ms.blocks[i])
@@ -34,20 +57,69 @@ func (ms *memoryStorage) GetAll(from uint32, to uint32) ([]*Block, error) {
 	return result, nil
 }
 
-func (ms *memoryStorage) Put(b *Block) error {
+func (ms *memoryStorage) Put(b *Block, receipts []*Receipt) error {
 	ms.lock.Lock()
 	defer ms.lock.Unlock()
+	if int(b.Header.Height) != len(ms.blocks) {
+		return ErrStorageHeightMismatch
+	}
+	ms.lookup[b.Header.Hash().String()] = b.Header.Height
 	ms.headers = append(ms.headers, b.Header)
 	ms.blocks = append(ms.blocks, b)
+	ms.receipts = append(ms.receipts, receipts)
 	return nil
 }
 
 func (ms *memoryStorage) Get(h uint32) (*Block, error) {
 	ms.lock.RLock()
 	defer ms.lock.RUnlock()
-	idx := int(h) + 1
-	if len(ms.blocks) <= idx {
-		return nil, errors.New("height too high")
+	if len(ms.blocks) <= int(h) {
+		return nil, ErrBlockNotFound
+	}
+	return ms.blocks[h], nil
+}
+
+func (ms *memoryStorage) GetReceipts(h uint32) ([]*Receipt, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if len(ms.receipts) <= int(h) {
+		return nil, ErrBlockNotFound
+	}
+	return ms.receipts[h], nil
+}
+
+func (ms *memoryStorage) GetByHash(h hash.Hash) (*Block, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	height, ok := ms.lookup[h.String()]
+	if !ok {
+		return nil, ErrBlockNotFound
 	}
-	return ms.blocks[idx], nil
+	return ms.blocks[height], nil
+}
+
+// Rewind removes every block above the given height.
+func (ms *memoryStorage) Rewind(h uint32) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if len(ms.blocks) <= int(h) {
+		return ErrBlockNotFound
+	}
+	for _, b := range ms.blocks[h+1:] {
+		delete(ms.lookup, b.Header.Hash().String())
+	}
+	ms.headers = ms.headers[:h+1]
+	ms.blocks = ms.blocks[:h+1]
+	ms.receipts = ms.receipts[:h+1]
+	return nil
+}
+
+func (ms *memoryStorage) Size() int {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	return len(ms.blocks)
+}
+
+func (ms *memoryStorage) Close() error {
+	return nil
 }
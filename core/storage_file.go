@@ -0,0 +1,415 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/igumus/chainx/hash"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	blockLogFileName   = "blocks.log"
+	blockIndexFileName = "blocks.idx"
+)
+
+var ErrCorruptedIndex = errors.New("block index is corrupted")
+
+// version of the block record layout
+const blockRecordVersion byte = 0x1
+
+// blockRecord is a single entry of the block log: a block stored together
+// with receipts of its transactions.
+//
+// On disk a record is encoded (little endian) as:
+//
+//	version (1 byte) | canonical block | receipt count (4 bytes) |
+//	count times: canonical receipt | error length (4 bytes) | error
+//
+// Error messages are not part of canonical receipts, they are stored
+// next to them so receipts read back are complete.
+type blockRecord struct {
+	Block    *Block
+	Receipts []*Receipt
+}
+
+func (rec *blockRecord) bytes() []byte {
+	w := &canonicalWriter{}
+	w.u8(blockRecordVersion)
+	w.block(rec.Block)
+	w.u32(uint32(len(rec.Receipts)))
+	for _, r := range rec.Receipts {
+		w.receipt(r)
+		w.bytes([]byte(r.Error))
+	}
+	return w.buf.Bytes()
+}
+
+func blockRecordFromBytes(b []byte) (*blockRecord, error) {
+	r := newCanonicalReader(b)
+	if v := r.u8(); r.err == nil && v != blockRecordVersion {
+		return nil, ErrEncodingVersion
+	}
+	rec := &blockRecord{Block: r.block()}
+	count := r.u32()
+	// every receipt takes more than 4 bytes
+	if r.err == nil && int(count) > r.r.Len() {
+		return nil, ErrEncodingMalformed
+	}
+	rec.Receipts = make([]*Receipt, 0, count)
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		receipt := r.receipt()
+		receipt.Error = string(r.bytes())
+		rec.Receipts = append(rec.Receipts, receipt)
+	}
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// indexEntry locates a single block inside the block log. Entries are stored
+// in height order, so the position of an entry in the index is the height of
+// the block it points to.
+//
+// On disk an entry is encoded (little endian) as:
+//
+//	offset (8 bytes) | size (4 bytes) | hash length (1 byte) | hash
+type indexEntry struct {
+	offset int64
+	size   uint32
+	hash   hash.Hash
+}
+
+func (e *indexEntry) bytes() []byte {
+	buf := make([]byte, 13+len(e.hash))
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(e.offset))
+	binary.LittleEndian.PutUint32(buf[8:12], e.size)
+	buf[12] = byte(len(e.hash))
+	copy(buf[13:], e.hash)
+	return buf
+}
+
+func readIndexEntry(r io.Reader) (*indexEntry, int64, error) {
+	head := make([]byte, 13)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, 0, err
+	}
+	h := make([]byte, int(head[12]))
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, 0, err
+	}
+	entry := &indexEntry{
+		offset: int64(binary.LittleEndian.Uint64(head[0:8])),
+		size:   binary.LittleEndian.Uint32(head[8:12]),
+		hash:   hash.Hash(h),
+	}
+	return entry, int64(len(head) + len(h)), nil
+}
+
+// fileStorage is an append-only, disk backed Storage implementation. Blocks
+// are appended to the block log and their location is recorded in the
+// index file after the block itself is durably written. A crash between
+// the two writes leaves an unindexed tail in the log which is discarded
+// when the storage is reopened.
+type fileStorage struct {
+	lock      sync.RWMutex
+	dir       string
+	blockLog  *os.File
+	index     *os.File
+	logSize   int64
+	indexSize int64
+	entries   []*indexEntry
+	lookup    map[string]uint32 // block hash to height
+	readOnly  bool
+}
+
+// NewFileStorage opens (or creates) a block storage rooted at the given
+// directory.
+func NewFileStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	fs, err := openFileStorage(dir, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// NewReadOnlyFileStorage opens an existing block storage rooted at the
+// given directory for reading. Nothing is created or truncated: an
+// unindexed tail of the block log is ignored, and Put and Rewind fail
+// with ErrStorageReadOnly.
+func NewReadOnlyFileStorage(dir string) (Storage, error) {
+	fs, err := openFileStorage(dir, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func openFileStorage(dir string, flag int) (*fileStorage, error) {
+	blockLog, err := os.OpenFile(filepath.Join(dir, blockLogFileName), flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := os.OpenFile(filepath.Join(dir, blockIndexFileName), flag, 0o644)
+	if err != nil {
+		blockLog.Close()
+		return nil, err
+	}
+
+	fs := &fileStorage{
+		dir:      dir,
+		blockLog: blockLog,
+		index:    index,
+		entries:  []*indexEntry{},
+		lookup:   make(map[string]uint32),
+		readOnly: flag == os.O_RDONLY,
+	}
+
+	if err := fs.recover(); err != nil {
+		fs.Close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// recover loads the index into memory and truncates both files to the last
+// consistent entry, unless the storage is read only.
+func (fs *fileStorage) recover() error {
+	stat, err := fs.blockLog.Stat()
+	if err != nil {
+		return err
+	}
+	logSize := stat.Size()
+
+	if _, err := fs.index.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var (
+		indexSize int64
+		dataSize  int64
+	)
+
+	for {
+		entry, n, err := readIndexEntry(fs.index)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if entry.offset != dataSize || entry.offset+int64(entry.size) > logSize {
+			break
+		}
+		fs.lookup[entry.hash.String()] = uint32(len(fs.entries))
+		fs.entries = append(fs.entries, entry)
+		indexSize += n
+		dataSize = entry.offset + int64(entry.size)
+	}
+
+	fs.logSize = dataSize
+	fs.indexSize = indexSize
+	if fs.readOnly {
+		return nil
+	}
+
+	if err := fs.index.Truncate(indexSize); err != nil {
+		return err
+	}
+	if logSize != dataSize {
+		log.Warn().
+			Str("dir", fs.dir).
+			Int64("logSize", logSize).
+			Int64("indexedSize", dataSize).
+			Msg("discarding unindexed tail of block log")
+	}
+	return fs.blockLog.Truncate(dataSize)
+}
+
+func (fs *fileStorage) Put(b *Block, receipts []*Receipt) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if fs.readOnly {
+		return ErrStorageReadOnly
+	}
+	if int(b.Header.Height) != len(fs.entries) {
+		return ErrStorageHeightMismatch
+	}
+
+	data := (&blockRecord{Block: b, Receipts: receipts}).bytes()
+	entry := &indexEntry{
+		offset: fs.logSize,
+		size:   uint32(len(data)),
+		hash:   b.Header.Hash(),
+	}
+
+	record := entry.bytes()
+	if err := fs.write(data, record); err != nil {
+		// drop partially written data, so storage stays as it was
+		// before the failed put
+		fs.index.Truncate(fs.indexSize)
+		fs.blockLog.Truncate(fs.logSize)
+		return err
+	}
+
+	fs.logSize += int64(entry.size)
+	fs.indexSize += int64(len(record))
+	fs.lookup[entry.hash.String()] = uint32(len(fs.entries))
+	fs.entries = append(fs.entries, entry)
+	return nil
+}
+
+// write durably appends block data to the log, then its record to the
+// index. Caller must hold the storage lock.
+func (fs *fileStorage) write(data []byte, record []byte) error {
+	if _, err := fs.blockLog.WriteAt(data, fs.logSize); err != nil {
+		return err
+	}
+	if err := fs.blockLog.Sync(); err != nil {
+		return err
+	}
+	if _, err := fs.index.WriteAt(record, fs.indexSize); err != nil {
+		return err
+	}
+	return fs.index.Sync()
+}
+
+func (fs *fileStorage) read(h uint32) (*blockRecord, error) {
+	if len(fs.entries) <= int(h) {
+		return nil, ErrBlockNotFound
+	}
+	entry := fs.entries[h]
+
+	data := make([]byte, entry.size)
+	if _, err := fs.blockLog.ReadAt(data, entry.offset); err != nil {
+		return nil, err
+	}
+
+	record, err := blockRecordFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if record.Block == nil || !record.Block.Header.Hash().IsEqual(entry.hash) {
+		return nil, ErrCorruptedIndex
+	}
+	return record, nil
+}
+
+func (fs *fileStorage) get(h uint32) (*Block, error) {
+	record, err := fs.read(h)
+	if err != nil {
+		return nil, err
+	}
+	return record.Block, nil
+}
+
+func (fs *fileStorage) GetReceipts(h uint32) ([]*Receipt, error) {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+	record, err := fs.read(h)
+	if err != nil {
+		return nil, err
+	}
+	if record.Receipts == nil {
+		return []*Receipt{}, nil
+	}
+	return record.Receipts, nil
+}
+
+func (fs *fileStorage) Get(h uint32) (*Block, error) {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+	return fs.get(h)
+}
+
+func (fs *fileStorage) GetByHash(h hash.Hash) (*Block, error) {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+	height, ok := fs.lookup[h.String()]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return fs.get(height)
+}
+
+func (fs *fileStorage) GetAll(from uint32, to uint32) ([]*Block, error) {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+	result := []*Block{}
+	for i := from; i < to+1; i++ {
+		b, err := fs.get(i)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+// Rewind removes every block above the given height by truncating the
+// block log and the index.
+func (fs *fileStorage) Rewind(h uint32) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if fs.readOnly {
+		return ErrStorageReadOnly
+	}
+	if len(fs.entries) <= int(h) {
+		return ErrBlockNotFound
+	}
+
+	var indexSize int64
+	for _, entry := range fs.entries[:h+1] {
+		indexSize += int64(13 + len(entry.hash))
+	}
+	last := fs.entries[h]
+	logSize := last.offset + int64(last.size)
+
+	// index truncated first, so a crash in between leaves an unindexed
+	// tail in the log which is discarded on reopen
+	if err := fs.index.Truncate(indexSize); err != nil {
+		return err
+	}
+	if err := fs.index.Sync(); err != nil {
+		return err
+	}
+	if err := fs.blockLog.Truncate(logSize); err != nil {
+		return err
+	}
+
+	for _, entry := range fs.entries[h+1:] {
+		delete(fs.lookup, entry.hash.String())
+	}
+	fs.entries = fs.entries[:h+1]
+	fs.indexSize = indexSize
+	fs.logSize = logSize
+	return nil
+}
+
+func (fs *fileStorage) Size() int {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+	return len(fs.entries)
+}
+
+func (fs *fileStorage) Close() error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	logErr := fs.blockLog.Close()
+	if err := fs.index.Close(); err != nil {
+		return err
+	}
+	return logErr
+}
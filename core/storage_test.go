@@ -0,0 +1,216 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestBlocks(t *testing.T, count int) []*Block {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	genesis, err := GenesisBlock()
+	require.Nil(t, err)
+
+	blocks := []*Block{genesis}
+	for i := 1; i < count; i++ {
+		txs := []*Transaction{
+			createSignedTransaction(t, []byte("foo")),
+		}
+		b, err := NewBlock(blocks[i-1].Header, txs)
+		require.Nil(t, err)
+		require.Nil(t, b.Sign(kp))
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func TestMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	blocks := createTestBlocks(t, 3)
+
+	for _, b := range blocks {
+		require.Nil(t, storage.Put(b, nil))
+	}
+	require.Equal(t, 3, storage.Size())
+	require.Equal(t, ErrStorageHeightMismatch, storage.Put(blocks[1], nil))
+
+	b, err := storage.Get(1)
+	require.Nil(t, err)
+	require.Equal(t, blocks[1].Header.Hash(), b.Header.Hash())
+
+	_, err = storage.Get(3)
+	require.Equal(t, ErrBlockNotFound, err)
+
+	b, err = storage.GetByHash(blocks[2].Header.Hash())
+	require.Nil(t, err)
+	require.Equal(t, blocks[2].Header.Hash(), b.Header.Hash())
+
+	require.Nil(t, storage.Rewind(1))
+	_, err = storage.GetByHash(blocks[2].Header.Hash())
+	require.Equal(t, ErrBlockNotFound, err)
+}
+
+func TestFileStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	blocks := createTestBlocks(t, 4)
+
+	storage, err := NewFileStorage(dir)
+	require.Nil(t, err)
+	require.Equal(t, 0, storage.Size())
+	for _, b := range blocks {
+		require.Nil(t, storage.Put(b, nil))
+	}
+	require.Nil(t, storage.Close())
+
+	storage, err = NewFileStorage(dir)
+	require.Nil(t, err)
+	defer storage.Close()
+	require.Equal(t, len(blocks), storage.Size())
+
+	stored, err := storage.GetAll(0, uint32(len(blocks)-1))
+	require.Nil(t, err)
+	for i, b := range stored {
+		require.Equal(t, blocks[i].Header.Hash(), b.Header.Hash())
+		require.Equal(t, len(blocks[i].Transactions), len(b.Transactions))
+	}
+	require.Nil(t, stored[3].Verify())
+
+	b, err := storage.GetByHash(blocks[2].Header.Hash())
+	require.Nil(t, err)
+	require.Equal(t, blocks[2].Header.Hash(), b.Header.Hash())
+}
+
+func TestFileStorageDiscardsUnindexedTail(t *testing.T) {
+	dir := t.TempDir()
+	blocks := createTestBlocks(t, 2)
+
+	storage, err := NewFileStorage(dir)
+	require.Nil(t, err)
+	for _, b := range blocks {
+		require.Nil(t, storage.Put(b, nil))
+	}
+	require.Nil(t, storage.Close())
+
+	// simulate a crash after writing block data but before indexing it
+	f, err := os.OpenFile(filepath.Join(dir, blockLogFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.Nil(t, err)
+	_, err = f.Write([]byte("partial block"))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	storage, err = NewFileStorage(dir)
+	require.Nil(t, err)
+	defer storage.Close()
+	require.Equal(t, 2, storage.Size())
+
+	next := createTestBlocks(t, 3)[2]
+	next.Header.Height = 2
+	require.Nil(t, storage.Put(next, nil))
+	b, err := storage.Get(2)
+	require.Nil(t, err)
+	require.Equal(t, next.Header.Hash(), b.Header.Hash())
+}
+
+func TestFileStorageRewind(t *testing.T) {
+	dir := t.TempDir()
+	blocks := createTestBlocks(t, 4)
+
+	storage, err := NewFileStorage(dir)
+	require.Nil(t, err)
+	for _, b := range blocks {
+		require.Nil(t, storage.Put(b, nil))
+	}
+
+	require.Nil(t, storage.Rewind(1))
+	require.Equal(t, 2, storage.Size())
+	_, err = storage.Get(2)
+	require.Equal(t, ErrBlockNotFound, err)
+
+	require.Nil(t, storage.Put(blocks[2], nil))
+	require.Nil(t, storage.Close())
+
+	storage, err = NewFileStorage(dir)
+	require.Nil(t, err)
+	defer storage.Close()
+	require.Equal(t, 3, storage.Size())
+	b, err := storage.Get(2)
+	require.Nil(t, err)
+	require.Equal(t, blocks[2].Header.Hash(), b.Header.Hash())
+}
+
+func TestFileStorageReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	blocks := createTestBlocks(t, 2)
+
+	// nothing is created for a missing storage
+	missing := filepath.Join(dir, "missing")
+	_, err := NewReadOnlyFileStorage(missing)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(missing)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	storage, err := NewFileStorage(dir)
+	require.Nil(t, err)
+	for _, b := range blocks {
+		require.Nil(t, storage.Put(b, nil))
+	}
+	require.Nil(t, storage.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, blockLogFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.Nil(t, err)
+	_, err = f.Write([]byte("partial block"))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	stat, err := os.Stat(filepath.Join(dir, blockLogFileName))
+	require.Nil(t, err)
+
+	storage, err = NewReadOnlyFileStorage(dir)
+	require.Nil(t, err)
+	require.Equal(t, 2, storage.Size())
+	b, err := storage.Get(1)
+	require.Nil(t, err)
+	require.Equal(t, blocks[1].Header.Hash(), b.Header.Hash())
+	require.Equal(t, ErrStorageReadOnly, storage.Put(createTestBlocks(t, 3)[2], nil))
+	require.Equal(t, ErrStorageReadOnly, storage.Rewind(0))
+	require.Nil(t, storage.Close())
+
+	// unindexed tail is left in place
+	reopened, err := os.Stat(filepath.Join(dir, blockLogFileName))
+	require.Nil(t, err)
+	require.Equal(t, stat.Size(), reopened.Size())
+}
+
+func TestBlockRecordEncoding(t *testing.T) {
+	b := createTestBlocks(t, 2)[1]
+	receipts := []*Receipt{{
+		TxHash:  b.Transactions[0].Hash(),
+		Status:  ReceiptFailed,
+		Code:    ReceiptCodeOutOfGas,
+		Error:   ErrOutOfGas.Error(),
+		GasUsed: 42,
+		Writes:  [][]byte{[]byte("a"), []byte("b")},
+		Logs:    [][]byte{{1, 2}},
+	}}
+
+	data := (&blockRecord{Block: b, Receipts: receipts}).bytes()
+	require.Equal(t, blockRecordVersion, data[0])
+	require.Equal(t, b.Bytes(), data[1:1+len(b.Bytes())])
+
+	record, err := blockRecordFromBytes(data)
+	require.Nil(t, err)
+	require.Equal(t, b.Header.Hash(), record.Block.Header.Hash())
+	require.Equal(t, receipts, record.Receipts)
+
+	// records of other layout versions are rejected
+	data[0] = blockRecordVersion + 1
+	_, err = blockRecordFromBytes(data)
+	require.Equal(t, ErrEncodingVersion, err)
+
+	_, err = blockRecordFromBytes(data[:len(data)-1])
+	require.NotNil(t, err)
+}
@@ -1,30 +1,115 @@
 package core
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/igumus/chainx/crypto"
 	"github.com/igumus/chainx/hash"
 )
 
+// chain id used when none is configured
+const DefaultChainID uint32 = 1
+
+var (
+	ErrTxChainIDNotValid = errors.New("transaction chain id is invalid")
+	ErrTxTypeNotValid    = errors.New("transaction type is invalid")
+)
+
+type TxType byte
+
+const (
+	// executes transaction data as contract bytecode in the recipient
+	// contract, or in a new contract when there is no recipient
+	TxContract TxType = 0x0
+	// only moves value from sender to recipient
+	TxTransfer TxType = 0x1
+)
+
+func (t TxType) isUnknown() bool {
+	return t != TxContract && t != TxTransfer
+}
+
 type Transaction struct {
+	ChainID   uint32
+	Type      TxType
+	To        crypto.Address
+	Value     uint64
+	Nonce     uint64
+	GasLimit  uint64
+	GasPrice  uint64
 	Data      []byte
 	Signature *crypto.Signature
 }
 
 func NewTransaction(data []byte) *Transaction {
 	return &Transaction{
-		Data: data,
+		ChainID:  DefaultChainID,
+		Type:     TxContract,
+		GasLimit: DefaultTxGasLimit,
+		Data:     data,
+	}
+}
+
+func NewTransferTransaction(to crypto.Address, value uint64, nonce uint64) *Transaction {
+	return &Transaction{
+		ChainID:  DefaultChainID,
+		Type:     TxTransfer,
+		To:       to,
+		Value:    value,
+		Nonce:    nonce,
+		GasLimit: TxBaseGas,
 	}
 }
 
+// signingBytes returns canonical encoding of every transaction field
+// covered by the signature. Chain id and sender nonce make signed bytes
+// unique, so a signature can neither be replayed on the same chain nor
+// reused on another chain.
+func (tx *Transaction) signingBytes() []byte {
+	w := &canonicalWriter{}
+	w.unsignedTransaction(tx)
+	return w.buf.Bytes()
+}
+
+// signingHash is the digest signed by the sender.
+func (tx *Transaction) signingHash() hash.Hash {
+	return hash.CreateHash(tx.signingBytes())
+}
+
+// Bytes returns canonical encoding of the transaction, including its
+// signature.
+func (tx *Transaction) Bytes() []byte {
+	w := &canonicalWriter{}
+	w.transaction(tx)
+	return w.buf.Bytes()
+}
+
+// Hash identifies the transaction. Besides signed bytes it covers the
+// public key of the signer, so identical payloads sent by different
+// accounts do not collide.
 func (tx *Transaction) Hash() hash.Hash {
-	return hash.CreateHash(tx.Data)
+	var pubKey []byte
+	if tx.Signature != nil {
+		pubKey = tx.Signature.PubKey
+	}
+	w := &canonicalWriter{}
+	w.unsignedTransaction(tx)
+	w.bytes(pubKey)
+	return hash.CreateHash(w.buf.Bytes())
+}
+
+// From returns address of the transaction sender, which is derived from
+// the public key of the signature.
+func (tx *Transaction) From() crypto.Address {
+	if tx.Signature == nil {
+		return crypto.Address{}
+	}
+	return tx.Signature.Address()
 }
 
 func (t *Transaction) Sign(kp *crypto.KeyPair) error {
-	signature, err := kp.Sign(t.Data)
+	signature, err := kp.Sign(t.signingHash())
 	if err != nil {
 		return err
 	}
@@ -33,19 +118,19 @@ func (t *Transaction) Sign(kp *crypto.KeyPair) error {
 }
 
 func (t *Transaction) Verify() error {
-	return t.Signature.Verify(t.Data)
+	return t.Signature.Verify(t.signingHash())
 }
 
+// calculateTransactionHash verifies given transactions and returns the
+// merkle root of their hashes.
 func calculateTransactionHash(txs []*Transaction) (hash.Hash, error) {
-	buf := new(bytes.Buffer)
-	for _, tx := range txs {
+	leaves := make([]hash.Hash, len(txs))
+	for i, tx := range txs {
 		if err := tx.Verify(); err != nil {
 			fmt.Printf("tx verification failed: %s\n", err)
 			return hash.ZeroHash, err
 		}
-		if _, err := buf.Write(tx.Data); err != nil {
-			return hash.ZeroHash, err
-		}
+		leaves[i] = tx.Hash()
 	}
-	return hash.CreateHash(buf.Bytes()), nil
+	return hash.MerkleRoot(leaves), nil
 }
@@ -13,9 +13,7 @@ func createSignedTransaction(t *testing.T, data []byte) *Transaction {
 	require.Nil(t, err)
 	require.NotNil(t, kp)
 
-	tx := &Transaction{
-		Data: data,
-	}
+	tx := NewTransaction(data)
 
 	err = tx.Sign(kp)
 	require.Nil(t, err)
@@ -68,3 +66,57 @@ func TestTransactionEncode(t *testing.T) {
     err = DecodeTransaction(buf, decoded)
     require.Nil(t, decoded.Verify())
 }
+
+func TestTransactionHashCoversSender(t *testing.T) {
+	data := []byte("hello world")
+	a := createSignedTransaction(t, data)
+	b := createSignedTransaction(t, data)
+
+	require.Equal(t, a.signingHash(), b.signingHash())
+	require.NotEqual(t, a.Hash(), b.Hash())
+}
+
+func TestTransactionVerifyWithTamperedChainID(t *testing.T) {
+	tx := createSignedTransaction(t, []byte("hello world"))
+	tx.ChainID = DefaultChainID + 1
+	require.Equal(t, crypto.ErrInvalidSignature, tx.Verify())
+}
+
+func TestTransactionReplayProtection(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain(WithChainID(7), WithGenesisAlloc(sender.Address(), 100))
+	require.Nil(t, err)
+	require.Equal(t, uint32(7), bc.ChainID())
+
+	txpool, err := NewTXPool(WithChainReader(bc))
+	require.Nil(t, err)
+
+	// transaction signed for another chain
+	foreign := NewTransferTransaction(sender.Address(), 1, 0)
+	require.Nil(t, foreign.Sign(sender))
+	require.Equal(t, ErrTxChainIDNotValid, txpool.Add(foreign))
+
+	b, err := NewBlock(bc.CurrentHeader(), []*Transaction{foreign})
+	require.Nil(t, err)
+	require.Nil(t, b.Sign(sender))
+	require.Equal(t, ErrTxChainIDNotValid, bc.AddBlock(b))
+
+	tx := NewTransferTransaction(sender.Address(), 1, 0)
+	tx.ChainID = 7
+	require.Nil(t, tx.Sign(sender))
+	require.Nil(t, txpool.Add(tx))
+
+	_, err = bc.CreateBlock(sender, txpool.Transactions())
+	require.Nil(t, err)
+	txpool.Flush()
+
+	// executed transaction can not be submitted again
+	require.Equal(t, ErrTxNonceTooLow, txpool.Add(tx))
+
+	b, err = NewBlock(bc.CurrentHeader(), []*Transaction{tx})
+	require.Nil(t, err)
+	require.Nil(t, b.Sign(sender))
+	require.Equal(t, ErrTxNonceNotValid, bc.AddBlock(b))
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/igumus/chainx/hash"
+)
+
+var ErrStateProofNotVerified = errors.New("state proof not verified")
+
+// domain separation prefixes of trie node hashes
+const (
+	trieLeafPrefix byte = 0x00
+	trieNodePrefix byte = 0x01
+)
+
+// trieNode is a node of a sparse merkle tree keyed by the digest of
+// state keys. Subtrees holding a single leaf are collapsed into the
+// leaf, so the depth of the tree grows with the number of keys rather
+// than the digest size. Nodes are immutable: updates copy the nodes on
+// the path to the root and share the rest, so a state and the states
+// staged on it can hold their own tree cheaply. Empty subtree is nil
+// and its hash is ZeroHash.
+type trieNode struct {
+	left, right *trieNode
+	path        []byte // digest of the key, leaf only
+	key, value  []byte // leaf only
+	hash        hash.Hash
+}
+
+func (n *trieNode) isLeaf() bool {
+	return n.path != nil
+}
+
+func trieNodeHash(n *trieNode) hash.Hash {
+	if n == nil {
+		return hash.ZeroHash
+	}
+	return n.hash
+}
+
+func trieLeafHash(path []byte, valueHash hash.Hash) hash.Hash {
+	return hash.CreateHash(bytes.Join([][]byte{{trieLeafPrefix}, path, valueHash.Bytes()}, []byte{}))
+}
+
+func trieInnerHash(left, right hash.Hash) hash.Hash {
+	return hash.CreateHash(bytes.Join([][]byte{{trieNodePrefix}, left.Bytes(), right.Bytes()}, []byte{}))
+}
+
+func triePath(k []byte) []byte {
+	return hash.CreateHash(k).Digest()
+}
+
+// trieBit returns the bit of path at given depth, 0 means left.
+func trieBit(path []byte, depth int) byte {
+	return (path[depth/8] >> (7 - depth%8)) & 1
+}
+
+func newTrieLeaf(path, key, value []byte) *trieNode {
+	return &trieNode{
+		path:  path,
+		key:   key,
+		value: value,
+		hash:  trieLeafHash(path, hash.CreateHash(value)),
+	}
+}
+
+func newTrieInner(left, right *trieNode) *trieNode {
+	return &trieNode{
+		left:  left,
+		right: right,
+		hash:  trieInnerHash(trieNodeHash(left), trieNodeHash(right)),
+	}
+}
+
+// trieChildren orders child and its sibling by the bit of path at depth.
+func trieChildren(path []byte, depth int, child, sibling *trieNode) (*trieNode, *trieNode) {
+	if trieBit(path, depth) == 0 {
+		return child, sibling
+	}
+	return sibling, child
+}
+
+// trieSplit builds the subtree at depth holding two leaves with
+// different paths.
+func trieSplit(a, b *trieNode, depth int) *trieNode {
+	if trieBit(a.path, depth) == trieBit(b.path, depth) {
+		return newTrieInner(trieChildren(a.path, depth, trieSplit(a, b, depth+1), nil))
+	}
+	return newTrieInner(trieChildren(a.path, depth, a, b))
+}
+
+func trieInsert(n *trieNode, depth int, leaf *trieNode) *trieNode {
+	if n == nil {
+		return leaf
+	}
+	if n.isLeaf() {
+		if bytes.Equal(n.path, leaf.path) {
+			return leaf
+		}
+		return trieSplit(leaf, n, depth)
+	}
+	if trieBit(leaf.path, depth) == 0 {
+		return newTrieInner(trieInsert(n.left, depth+1, leaf), n.right)
+	}
+	return newTrieInner(n.left, trieInsert(n.right, depth+1, leaf))
+}
+
+func trieDelete(n *trieNode, depth int, path []byte) *trieNode {
+	if n == nil {
+		return nil
+	}
+	if n.isLeaf() {
+		if bytes.Equal(n.path, path) {
+			return nil
+		}
+		return n
+	}
+
+	child, sibling := n.left, n.right
+	if trieBit(path, depth) == 1 {
+		child, sibling = n.right, n.left
+	}
+	updated := trieDelete(child, depth+1, path)
+	if updated == child {
+		return n
+	}
+	// a subtree left with a single leaf collapses into the leaf
+	if updated == nil && (sibling == nil || sibling.isLeaf()) {
+		return sibling
+	}
+	if sibling == nil && updated.isLeaf() {
+		return updated
+	}
+	return newTrieInner(trieChildren(path, depth, updated, sibling))
+}
+
+func triePut(n *trieNode, k, v []byte) *trieNode {
+	return trieInsert(n, 0, newTrieLeaf(triePath(k), k, v))
+}
+
+func trieRemove(n *trieNode, k []byte) *trieNode {
+	return trieDelete(n, 0, triePath(k))
+}
+
+// trieGet returns value of given key from the tree.
+func trieGet(n *trieNode, k []byte) ([]byte, bool) {
+	path := triePath(k)
+	for depth := 0; n != nil && !n.isLeaf(); depth++ {
+		if trieBit(path, depth) == 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	if n == nil || !bytes.Equal(n.path, path) {
+		return nil, false
+	}
+	return n.value, true
+}
+
+// StateProof proves that Key has Value in a state with a given root or,
+// when Exists is false, that Key is not in the state.
+type StateProof struct {
+	Key    []byte
+	Value  []byte
+	Exists bool
+	// sibling hashes on the path of the key, from the root downwards
+	Siblings []hash.Hash
+	// leaf of another key found at the end of the path of an absent key
+	LeafPath  []byte
+	LeafValue hash.Hash
+}
+
+func trieProve(n *trieNode, k []byte) *StateProof {
+	path := triePath(k)
+	proof := &StateProof{
+		Key:      k,
+		Siblings: []hash.Hash{},
+	}
+	for depth := 0; n != nil && !n.isLeaf(); depth++ {
+		if trieBit(path, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, trieNodeHash(n.right))
+			n = n.left
+		} else {
+			proof.Siblings = append(proof.Siblings, trieNodeHash(n.left))
+			n = n.right
+		}
+	}
+
+	switch {
+	case n == nil:
+	case bytes.Equal(n.path, path):
+		proof.Exists = true
+		proof.Value = n.value
+	default:
+		proof.LeafPath = n.path
+		proof.LeafValue = hash.CreateHash(n.value)
+	}
+	return proof
+}
+
+// Verify checks the proof against given state root.
+func (p *StateProof) Verify(root hash.Hash) error {
+	path := triePath(p.Key)
+	if len(p.Siblings) > len(path)*8 {
+		return ErrStateProofNotVerified
+	}
+
+	var current hash.Hash
+	switch {
+	case p.Exists:
+		current = trieLeafHash(path, hash.CreateHash(p.Value))
+	case p.LeafPath != nil:
+		// the leaf must be a different key sharing the proven prefix
+		if len(p.LeafPath) != len(path) || bytes.Equal(p.LeafPath, path) {
+			return ErrStateProofNotVerified
+		}
+		for depth := range p.Siblings {
+			if trieBit(p.LeafPath, depth) != trieBit(path, depth) {
+				return ErrStateProofNotVerified
+			}
+		}
+		current = trieLeafHash(p.LeafPath, p.LeafValue)
+	default:
+		current = hash.ZeroHash
+	}
+
+	for depth := len(p.Siblings) - 1; depth >= 0; depth-- {
+		if trieBit(path, depth) == 0 {
+			current = trieInnerHash(current, p.Siblings[depth])
+		} else {
+			current = trieInnerHash(p.Siblings[depth], current)
+		}
+	}
+	if !current.IsEqual(root) {
+		return ErrStateProofNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/igumus/chainx/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateTrieUpdates(t *testing.T) {
+	a := NewState()
+	for i := 0; i < 64; i++ {
+		a.Put([]byte(fmt.Sprintf("key-%d", i)), []byte{byte(i)})
+	}
+	b := NewState()
+	for i := 63; i >= 0; i-- {
+		b.Put([]byte(fmt.Sprintf("key-%d", i)), []byte{byte(i)})
+	}
+	require.Equal(t, a.Root(), b.Root())
+
+	// deleting keys restores the root of the remaining content
+	for i := 32; i < 64; i++ {
+		a.Delete([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	c := NewState()
+	for i := 0; i < 32; i++ {
+		c.Put([]byte(fmt.Sprintf("key-%d", i)), []byte{byte(i)})
+	}
+	require.Equal(t, c.Root(), a.Root())
+
+	for i := 0; i < 32; i++ {
+		a.Delete([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	require.True(t, a.Root().IsZero())
+}
+
+func TestStateProof(t *testing.T) {
+	s := NewState()
+	for i := 0; i < 16; i++ {
+		s.Put([]byte(fmt.Sprintf("key-%d", i)), []byte{byte(i)})
+	}
+	root := s.Root()
+
+	proof := s.Prove([]byte("key-3"))
+	require.True(t, proof.Exists)
+	require.Equal(t, []byte{3}, proof.Value)
+	require.Nil(t, proof.Verify(root))
+
+	proof.Value = []byte{4}
+	require.Equal(t, ErrStateProofNotVerified, proof.Verify(root))
+
+	for i := 0; i < 16; i++ {
+		proof := s.Prove([]byte(fmt.Sprintf("missing-%d", i)))
+		require.False(t, proof.Exists)
+		require.Nil(t, proof.Verify(root))
+
+		// absent key cannot be presented as present
+		proof.Exists = true
+		require.Equal(t, ErrStateProofNotVerified, proof.Verify(root))
+	}
+
+	// present key cannot be presented as absent
+	proof = s.Prove([]byte("key-5"))
+	proof.Exists = false
+	proof.Value = nil
+	require.Equal(t, ErrStateProofNotVerified, proof.Verify(root))
+
+	require.Nil(t, NewState().Prove([]byte("foo")).Verify(NewState().Root()))
+}
+
+func TestBlockChainStateProof(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+	tx := createSignedTransaction(t, createStoreContract('a', 1))
+	_, err = bc.CreateBlock(kp, []*Transaction{tx})
+	require.Nil(t, err)
+
+	proof, header, err := bc.GetStateProof(ContractKey(createdContract(tx), []byte("a")))
+	require.Nil(t, err)
+	require.True(t, proof.Exists)
+	require.Nil(t, proof.Verify(header.StateRoot))
+
+	proof, header, err = bc.GetStateProof(ContractKey(createdContract(tx), []byte("b")))
+	require.Nil(t, err)
+	require.False(t, proof.Exists)
+	require.Nil(t, proof.Verify(header.StateRoot))
+}
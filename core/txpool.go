@@ -10,6 +10,8 @@ type TXPool interface {
 	Add(*Transaction) error
 	Contains(*Transaction) bool
 	Transactions() []*Transaction
+	Remove(...*Transaction)
+	Prune()
 	Size() int
 	Flush()
 }
@@ -48,16 +50,21 @@ type pool struct {
 	lock   sync.RWMutex
 	lookup map[string]hash.Hash
 	items  []*Transaction
+	chain  ChainReader
 }
 
-func NewTXPool() (TXPool, error) {
+func NewTXPool(opts ...TXPoolOption) (TXPool, error) {
+	options := createTXPoolOptions(opts...)
 	return &pool{
 		lookup: make(map[string]hash.Hash),
 		items:  []*Transaction{},
+		chain:  options.chain,
 	}, nil
 }
 
 func (t *pool) Transactions() []*Transaction {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
 	return t.items
 }
 
@@ -66,17 +73,124 @@ func (t *pool) Add(tx *Transaction) error {
 		if err := tx.Verify(); err != nil {
 			return err
 		}
+		if err := verifyTransactionData(tx); err != nil {
+			return err
+		}
 
 		t.lock.Lock()
+		defer t.lock.Unlock()
+		if err := t.validateAccount(tx); err != nil {
+			return err
+		}
 		txhash := tx.Hash()
 		t.lookup[txhash.String()] = txhash
 		t.items = append(t.items, tx)
-		t.lock.Unlock()
 	}
 
 	return nil
 }
 
+// validateAccount checks that the transaction is signed for this chain,
+// covers the base gas, its sender can afford value and the fee of the
+// whole gas limit together with already pending transactions,
+// and the nonce follows the pending ones. Transactions with a nonce
+// lower than the account nonce are replays of executed transactions.
+// Caller must hold the pool lock.
+func (t *pool) validateAccount(tx *Transaction) error {
+	if t.chain == nil {
+		return nil
+	}
+
+	if tx.ChainID != t.chain.ChainID() {
+		return ErrTxChainIDNotValid
+	}
+	if tx.GasLimit < TxBaseGas {
+		return ErrTxIntrinsicGas
+	}
+	cost, ok := maxTransactionCost(tx)
+	if !ok {
+		return ErrInsufficientBalance
+	}
+
+	from := tx.From()
+	account, err := t.chain.GetAccount(from)
+	if err != nil {
+		return err
+	}
+
+	if tx.Nonce < account.Nonce {
+		return ErrTxNonceTooLow
+	}
+
+	nonce := account.Nonce
+	spent := uint64(0)
+	for _, item := range t.items {
+		if item.From() == from {
+			nonce++
+			// pending transactions were checked when added
+			itemCost, _ := maxTransactionCost(item)
+			spent += itemCost
+		}
+	}
+
+	if tx.Nonce != nonce {
+		return ErrTxNonceNotValid
+	}
+	if account.Balance < spent || account.Balance-spent < cost {
+		return ErrInsufficientBalance
+	}
+	return nil
+}
+
+// Prune drops transactions which are already executed by the chain,
+// i.e. whose nonce is below the current nonce of the sender.
+func (t *pool) Prune() {
+	if t.chain == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	items := make([]*Transaction, 0, len(t.items))
+	for _, item := range t.items {
+		account, err := t.chain.GetAccount(item.From())
+		if err == nil && item.Nonce < account.Nonce {
+			delete(t.lookup, item.Hash().String())
+			continue
+		}
+		items = append(items, item)
+	}
+	t.items = items
+}
+
+// Remove drops given transactions from the pool, usually because they
+// are included in a block.
+func (t *pool) Remove(txs ...*Transaction) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	removed := false
+	for _, tx := range txs {
+		key := tx.Hash().String()
+		if _, ok := t.lookup[key]; ok {
+			delete(t.lookup, key)
+			removed = true
+		}
+	}
+	if !removed {
+		return
+	}
+
+	items := make([]*Transaction, 0, len(t.lookup))
+	for _, item := range t.items {
+		if _, ok := t.lookup[item.Hash().String()]; ok {
+			items = append(items, item)
+		}
+	}
+	t.items = items
+}
+
 func (t *pool) Contains(tx *Transaction) bool {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
@@ -1,7 +1,7 @@
 package core
 
 import (
-	"fmt"
+	"errors"
 	"testing"
 
 	"github.com/igumus/chainx/crypto"
@@ -22,7 +22,7 @@ func TestTransactionPoolAdd(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 0, txpool.Size())
 
-	tx := NewTransaction([]byte("foo"))
+	tx := NewTransaction(createStoreContract('f', 0))
 	err = tx.Sign(keypair)
 	assert.Nil(t, err)
 
@@ -44,7 +44,7 @@ func TestTransactionPoolFlush(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 0, txpool.Size())
 
-	tx := NewTransaction([]byte("foo"))
+	tx := NewTransaction(createStoreContract('f', 0))
 	err = tx.Sign(keypair)
 	assert.Nil(t, err)
 
@@ -69,7 +69,7 @@ func TestTransactionPoolList(t *testing.T) {
 
 	size := 10
 	for i := 0; i < size; i++ {
-		tx := NewTransaction([]byte(fmt.Sprintf("foo_%d", i)))
+		tx := NewTransaction(createStoreContract('f', byte(i)))
 		err = tx.Sign(keypair)
 		assert.Nil(t, err)
 
@@ -80,7 +80,85 @@ func TestTransactionPoolList(t *testing.T) {
 
 	txs := txpool.Transactions()
 	for i := 0; i < size; i++ {
-		assert.Equal(t, []byte(fmt.Sprintf("foo_%d", i)), txs[i].Data)
+		assert.Equal(t, createStoreContract('f', byte(i)), txs[i].Data)
 	}
 
 }
+
+func TestTransactionPoolAccountValidation(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	assert.Nil(t, err)
+	receiver, err := crypto.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	bc, err := NewBlockChain(WithGenesisAlloc(sender.Address(), 100))
+	assert.Nil(t, err)
+
+	txpool, err := NewTXPool(WithChainReader(bc))
+	assert.Nil(t, err)
+
+	transfer := func(value uint64, nonce uint64) *Transaction {
+		tx := NewTransferTransaction(receiver.Address(), value, nonce)
+		assert.Nil(t, tx.Sign(sender))
+		return tx
+	}
+
+	assert.Equal(t, ErrTxNonceNotValid, txpool.Add(transfer(10, 1)))
+	assert.Nil(t, txpool.Add(transfer(60, 0)))
+	// pending transfers are taken into account
+	assert.Equal(t, ErrInsufficientBalance, txpool.Add(transfer(50, 1)))
+	assert.Nil(t, txpool.Add(transfer(40, 1)))
+	assert.Equal(t, 2, txpool.Size())
+
+	_, err = bc.CreateBlock(sender, txpool.Transactions())
+	assert.Nil(t, err)
+	txpool.Remove(txpool.Transactions()...)
+	assert.Equal(t, 0, txpool.Size())
+
+	assert.Equal(t, ErrTxNonceTooLow, txpool.Add(transfer(0, 1)))
+
+	unknown := NewTransferTransaction(receiver.Address(), 10, 2)
+	unknown.Type = 0x7
+	assert.Nil(t, unknown.Sign(sender))
+	assert.Equal(t, ErrTxTypeNotValid, txpool.Add(unknown))
+}
+
+func TestTransactionPoolRemove(t *testing.T) {
+	keypair, err := crypto.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	txpool, err := NewTXPool()
+	assert.Nil(t, err)
+
+	txs := []*Transaction{}
+	for i := 0; i < 3; i++ {
+		tx := NewTransaction(createStoreContract('f', byte(i)))
+		assert.Nil(t, tx.Sign(keypair))
+		assert.Nil(t, txpool.Add(tx))
+		txs = append(txs, tx)
+	}
+
+	txpool.Remove(txs[1])
+	assert.Equal(t, 2, txpool.Size())
+	assert.False(t, txpool.Contains(txs[1]))
+	assert.Equal(t, []*Transaction{txs[0], txs[2]}, txpool.Transactions())
+}
+
+func TestTransactionPoolBytecodeVerification(t *testing.T) {
+	keypair, err := crypto.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	txpool, err := NewTXPool()
+	assert.Nil(t, err)
+
+	tx := NewTransaction([]byte{0x01, byte(InstrPushInt), byte(InstrAdd)})
+	assert.Nil(t, tx.Sign(keypair))
+
+	err = txpool.Add(tx)
+	var berr *BytecodeError
+	assert.True(t, errors.As(err, &berr))
+	assert.Equal(t, 2, berr.Offset)
+	assert.Equal(t, InstrAdd, berr.Instr)
+	assert.ErrorIs(t, err, ErrStackUnderflow)
+	assert.Equal(t, 0, txpool.Size())
+}
@@ -2,9 +2,23 @@ package core
 
 import (
 	"encoding/binary"
-	"fmt"
+	"errors"
+
+	"github.com/igumus/chainx/crypto"
+)
+
+var (
+	ErrContractAddressNotValid = errors.New("contract address is invalid")
+	ErrBytecodeEmpty           = errors.New("bytecode is empty")
+	ErrInstructionUnknown      = errors.New("instruction is unknown")
+	ErrStackUnderflow          = errors.New("stack underflow")
+	ErrStackOverflow           = errors.New("stack overflow")
+	ErrOperandType             = errors.New("operand type is invalid")
 )
 
+// maximum number of values on the stack
+const stackSize = 1024
+
 type Instruction byte
 
 const (
@@ -18,6 +32,36 @@ const (
 	InstrMultiply Instruction = 0x10
 	InstrSub      Instruction = 0x11
 	InstrAdd      Instruction = 0x12
+
+	// pops a value and emits it into the transaction receipt
+	InstrLog Instruction = 0x13
+	// pops end and start keys, pushes key and value of at most operand
+	// many entries in range [start, end) followed by the entry count. An
+	// empty end key leaves the range open.
+	InstrLoadRange Instruction = 0x14
+	// pops a key and a contract address, pushes value of the key from
+	// the state of that contract
+	InstrLoadExternal Instruction = 0x15
+
+	// comparisons pop the top value and the value below it, and push 1
+	// if top is equal to, less than or greater than the other value, 0
+	// otherwise
+	InstrEq Instruction = 0x16
+	InstrLt Instruction = 0x17
+	InstrGt Instruction = 0x18
+
+	// boolean logic treats non zero values as true, pushes 1 or 0
+	InstrAnd Instruction = 0x19
+	InstrOr  Instruction = 0x1a
+	InstrNot Instruction = 0x1b
+
+	// jumps take a 2 byte little endian target offset as operand, which
+	// is the offset of the first byte of an instruction
+	InstrJump Instruction = 0x1c
+	// pops a value, jumps if it is non zero
+	InstrJumpIf Instruction = 0x1d
+	// stops execution successfully
+	InstrHalt Instruction = 0x1e
 )
 
 type stack struct {
@@ -45,45 +89,112 @@ func (s *stack) push(b any) {
 }
 
 type VM struct {
-	data          []byte // vm data
-	ip            int    // instruction pointer
-	stack         *stack // stack ds
-	strSize       int    // string length
-	contractState *State // current contract state
+	data          []byte         // vm data
+	code          *bytecode      // decoded vm data
+	ip            int            // instruction pointer
+	next          int            // index of the next instruction to run
+	halted        bool           // execution stopped by InstrHalt
+	stack         *stack         // stack ds
+	strSize       int            // string length
+	contract      crypto.Address // address of the running contract
+	contractState *State         // current contract state
+	gasLimit      uint64         // gas available for execution
+	gasUsed       uint64         // gas consumed so far
+	logs          [][]byte       // data emitted by InstrLog
+}
+
+// NewVM creates a VM running given bytecode as the contract with given
+// address. Values are stored and loaded in the namespace of the contract,
+// values of other contracts can only be read with InstrLoadExternal.
+// Execution is limited to the gas left for bytecode of a transaction
+// created with the default gas limit.
+func NewVM(data []byte, contract crypto.Address, contractState *State) *VM {
+	return NewVMWithGas(data, contract, contractState, defaultVMGas)
 }
 
-func NewVM(data []byte, contractState *State) *VM {
+// NewVMWithGas creates a VM which aborts with ErrOutOfGas once executed
+// instructions cost more than the given gas limit.
+func NewVMWithGas(data []byte, contract crypto.Address, contractState *State, gasLimit uint64) *VM {
 	return &VM{
 		data:          data,
-		stack:         newStack(1024),
+		stack:         newStack(stackSize),
+		contract:      contract,
 		contractState: contractState,
 		ip:            0,
 		strSize:       0,
+		gasLimit:      gasLimit,
+		gasUsed:       0,
+		logs:          [][]byte{},
 	}
 }
 
-func (vm *VM) Run() (*State, error) {
-	state := NewState()
-	for {
-		instr := vm.data[vm.ip]
+// Logs returns data emitted by executed InstrLog instructions.
+func (vm *VM) Logs() [][]byte {
+	return vm.logs
+}
+
+// GasUsed returns gas consumed by executed instructions. After running
+// out of gas, it is equal to the gas limit.
+func (vm *VM) GasUsed() uint64 {
+	return vm.gasUsed
+}
+
+func (vm *VM) useGas(instr Instruction) error {
+	return vm.consumeGas(instructionGas[instr])
+}
+
+func (vm *VM) consumeGas(cost uint64) error {
+	if vm.gasLimit-vm.gasUsed < cost {
+		vm.gasUsed = vm.gasLimit
+		return ErrOutOfGas
+	}
+	vm.gasUsed += cost
+	return nil
+}
 
-		if err := vm.exec(state, Instruction(instr)); err != nil {
-			return state, err
+// Run executes the bytecode on the contract state. When execution fails,
+// every change made on the contract state by the bytecode is reverted.
+func (vm *VM) Run() error {
+	snapshot := vm.contractState.Snapshot()
+	if err := vm.run(); err != nil {
+		if rerr := vm.contractState.RevertTo(snapshot); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+	return nil
+}
+
+func (vm *VM) run() error {
+	if len(vm.data) == 0 {
+		return ErrBytecodeEmpty
+	}
+	code, berr := decodeBytecode(vm.data)
+	if berr != nil {
+		return berr.Err
+	}
+	vm.code = code
+
+	for vm.next < len(code.ops) && !vm.halted {
+		vm.ip = code.ops[vm.next]
+		vm.next++
+		instr := Instruction(vm.data[vm.ip])
+
+		if err := vm.useGas(instr); err != nil {
+			return err
 		}
 
-		vm.ip++
-		if vm.ip > len(vm.data)-1 {
-			break
+		if err := vm.exec(instr); err != nil {
+			return err
 		}
 	}
-	return state, nil
+	return nil
 }
 
-func (vm *VM) exec(state *State, instr Instruction) error {
+func (vm *VM) exec(instr Instruction) error {
 	switch instr {
 	case InstrPushInt:
-		vm.stack.push(vm.data[vm.ip-1])
-		return nil
+		return vm.push(vm.data[vm.ip-1])
 	case InstrAdd:
 		return vm.add()
 	case InstrMultiply:
@@ -91,72 +202,227 @@ func (vm *VM) exec(state *State, instr Instruction) error {
 	case InstrSub:
 		return vm.substract()
 	case InstrPushByte:
-		vm.stack.push(vm.data[vm.ip-1])
-		return nil
+		return vm.push(vm.data[vm.ip-1])
 	case InstrStrCreate:
 		// check size which should be greater equal than 1
 		size := int(vm.data[vm.ip-1])
 		vm.strSize = size
 		return nil
 	case InstrStrPack:
-		// check size which should be greater equal than 1
-		size := vm.strSize
-		content := make([]byte, size)
-		for i := size - 1; i >= 0; i-- {
-			content[i] = vm.stack.pop().(byte)
+		content, err := vm.popString()
+		if err != nil {
+			return err
 		}
-		vm.stack.push(content)
-		vm.strSize = 0
-		return nil
+		return vm.push(content)
 	case InstrStore:
 		value, err := vm.toInt()
 		if err != nil {
 			return err
 		}
-		key := vm.stack.pop().([]byte)
+		key, err := vm.popBytes()
+		if err != nil {
+			return err
+		}
+		if isReservedKey(key) {
+			return ErrReservedStateKey
+		}
 		buf := make([]byte, 8)
 		binary.LittleEndian.PutUint64(buf, value)
-		if err := state.Put(key, buf); err != nil {
+		if err := vm.contractState.Put(ContractKey(vm.contract, key), buf); err != nil {
 			return err
 		}
 		return nil
 	case InstrLoadState:
-		// check size which should be greater equal than 1
-		size := vm.strSize
-		content := make([]byte, size)
-		for i := size - 1; i >= 0; i-- {
-			content[i] = vm.stack.pop().(byte)
+		content, err := vm.popString()
+		if err != nil {
+			return err
+		}
+		value, err := vm.contractState.Get(ContractKey(vm.contract, content))
+		if err != nil {
+			return err
+		}
+		return vm.push(value)
+	case InstrLog:
+		// strings are emitted as is, numbers as 8 byte little endian
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if data, ok := a.([]byte); ok {
+			vm.logs = append(vm.logs, data)
+			return nil
+		}
+		value, err := intValue(a)
+		if err != nil {
+			return err
 		}
-		value, err := vm.contractState.Get(content)
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, value)
+		vm.logs = append(vm.logs, buf)
+		return nil
+	case InstrLoadRange:
+		return vm.loadRange(int(vm.data[vm.ip-1]))
+	case InstrEq, InstrLt, InstrGt:
+		return vm.compare(instr)
+	case InstrAnd, InstrOr:
+		return vm.logic(instr)
+	case InstrNot:
+		va, err := vm.toInt()
 		if err != nil {
 			return err
 		}
-		vm.stack.push(value)
-		vm.strSize = 0
+		return vm.push(boolValue(va == 0))
+	case InstrJump:
+		vm.jump()
+		return nil
+	case InstrJumpIf:
+		cond, err := vm.toInt()
+		if err != nil {
+			return err
+		}
+		if cond != 0 {
+			vm.jump()
+		}
+		return nil
+	case InstrHalt:
+		vm.halted = true
 		return nil
+	case InstrLoadExternal:
+		key, err := vm.popBytes()
+		if err != nil {
+			return err
+		}
+		addr, err := vm.popBytes()
+		if err != nil {
+			return err
+		}
+		if len(addr) != len(crypto.Address{}) {
+			return ErrContractAddressNotValid
+		}
+		value, err := vm.contractState.Get(ContractKey(crypto.AddressFromBytes(addr), key))
+		if err != nil {
+			return err
+		}
+		return vm.push(value)
+	}
+	return ErrInstructionUnknown
+}
+
+func (vm *VM) pop() (any, error) {
+	if vm.stack.sp == 0 {
+		return nil, ErrStackUnderflow
+	}
+	return vm.stack.pop(), nil
+}
+
+func (vm *VM) push(v any) error {
+	if vm.stack.sp == len(vm.stack.data) {
+		return ErrStackOverflow
 	}
+	vm.stack.push(v)
 	return nil
 }
 
+func (vm *VM) popBytes() ([]byte, error) {
+	a, err := vm.pop()
+	if err != nil {
+		return nil, err
+	}
+	b, ok := a.([]byte)
+	if !ok {
+		return nil, ErrOperandType
+	}
+	return b, nil
+}
+
+// popString pops bytes of the string created by InstrStrCreate.
+func (vm *VM) popString() ([]byte, error) {
+	size := vm.strSize
+	vm.strSize = 0
+	content := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		a, err := vm.pop()
+		if err != nil {
+			return nil, err
+		}
+		c, ok := a.(byte)
+		if !ok {
+			return nil, ErrOperandType
+		}
+		content[i] = c
+	}
+	return content, nil
+}
+
+func (vm *VM) loadRange(limit int) error {
+	end, err := vm.popBytes()
+	if err != nil {
+		return err
+	}
+	start, err := vm.popBytes()
+	if err != nil {
+		return err
+	}
+
+	namespace := contractNamespace(vm.contract)
+	_, nsEnd := prefixRange(namespace)
+	start = ContractKey(vm.contract, start)
+	if len(end) == 0 {
+		end = nsEnd
+	} else {
+		end = ContractKey(vm.contract, end)
+	}
+
+	count := 0
+	vm.contractState.Iterate(start, end, func(k, v []byte) bool {
+		if count == limit {
+			return false
+		}
+		if err = vm.consumeGas(rangeEntryGas); err != nil {
+			return false
+		}
+		if err = vm.push(k[len(namespace):]); err != nil {
+			return false
+		}
+		if err = vm.push(v); err != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return vm.push(uint64(count))
+}
+
 func (vm *VM) toInt() (uint64, error) {
-	a := vm.stack.pop()
-	va := uint64(0)
+	a, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return intValue(a)
+}
+
+// intValue converts a stack value to a number, byte strings must be 8
+// byte little endian numbers.
+func intValue(a any) (uint64, error) {
 	switch t := a.(type) {
 	case uint64:
 		return t, nil
 	case byte:
-		va = uint64(t)
-		return va, nil
+		return uint64(t), nil
 	case []byte:
-		va = binary.LittleEndian.Uint64(t)
-		return va, nil
+		if len(t) != 8 {
+			return 0, ErrOperandType
+		}
+		return binary.LittleEndian.Uint64(t), nil
 	default:
-		return va, fmt.Errorf("unknown variable type: %T", a)
+		return 0, ErrOperandType
 	}
 }
 
 func (vm *VM) add() error {
-	//fmt.Printf("current stack: %+v\n", vm.stack)
 	va, err := vm.toInt()
 	if err != nil {
 		return err
@@ -166,8 +432,7 @@ func (vm *VM) add() error {
 		return err
 	}
 	c := va + vb
-	vm.stack.push(c)
-	return nil
+	return vm.push(c)
 }
 
 func (vm *VM) multiply() error {
@@ -180,8 +445,7 @@ func (vm *VM) multiply() error {
 		return err
 	}
 	c := va * vb
-	vm.stack.push(c)
-	return nil
+	return vm.push(c)
 }
 
 func (vm *VM) substract() error {
@@ -194,6 +458,52 @@ func (vm *VM) substract() error {
 		return err
 	}
 	c := va - vb
-	vm.stack.push(c)
-	return nil
+	return vm.push(c)
+}
+
+// jump moves execution to the target of the current jump instruction,
+// targets are validated while decoding.
+func (vm *VM) jump() {
+	vm.next = vm.code.targets[jumpTarget(vm.data, vm.ip)]
+}
+
+func (vm *VM) compare(instr Instruction) error {
+	va, err := vm.toInt()
+	if err != nil {
+		return err
+	}
+	vb, err := vm.toInt()
+	if err != nil {
+		return err
+	}
+	switch instr {
+	case InstrEq:
+		return vm.push(boolValue(va == vb))
+	case InstrLt:
+		return vm.push(boolValue(va < vb))
+	default:
+		return vm.push(boolValue(va > vb))
+	}
+}
+
+func (vm *VM) logic(instr Instruction) error {
+	va, err := vm.toInt()
+	if err != nil {
+		return err
+	}
+	vb, err := vm.toInt()
+	if err != nil {
+		return err
+	}
+	if instr == InstrAnd {
+		return vm.push(boolValue(va != 0 && vb != 0))
+	}
+	return vm.push(boolValue(va != 0 || vb != 0))
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
 }
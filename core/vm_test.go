@@ -2,8 +2,10 @@ package core
 
 import (
 	"encoding/binary"
+	"errors"
 	"testing"
 
+	"github.com/igumus/chainx/crypto"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,7 +14,7 @@ func TestVMInstrLoad(t *testing.T) {
 
 	foo := make([]byte, 8)
 	binary.LittleEndian.PutUint64(foo, uint64(0))
-	state.Put([]byte("foo"), foo)
+	state.Put(ContractKey(crypto.Address{}, []byte("foo")), foo)
 
 	contract := []byte{
 		0x03,
@@ -43,12 +45,10 @@ func TestVMInstrLoad(t *testing.T) {
 		// step#4 above; stores result with step#1 name on state
 	}
 
-	vm := NewVM(contract, state)
-	vstate, err := vm.Run()
-	require.Nil(t, err)
-	require.NotNil(t, vstate)
+	vm := NewVM(contract, crypto.Address{}, state)
+	require.Nil(t, vm.Run())
 
-	bvalue, err := vstate.Get([]byte("foo"))
+	bvalue, err := state.Get(ContractKey(crypto.Address{}, []byte("foo")))
 	require.Nil(t, err)
 
 	value := binary.LittleEndian.Uint64(bvalue)
@@ -76,12 +76,10 @@ func TestVMInstrStore(t *testing.T) {
 		byte(InstrStore),
 	}
 
-	vm := NewVM(contract, state)
-	vstate, err := vm.Run()
-	require.Nil(t, err)
-	require.NotNil(t, vstate)
+	vm := NewVM(contract, crypto.Address{}, state)
+	require.Nil(t, vm.Run())
 
-	bvalue, err := vstate.Get([]byte("foo"))
+	bvalue, err := state.Get(ContractKey(crypto.Address{}, []byte("foo")))
 	require.Nil(t, err)
 
 	value := binary.LittleEndian.Uint64(bvalue)
@@ -114,9 +112,9 @@ func TestVMStringCreation(t *testing.T) {
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			vm := NewVM(tc.contract, NewState())
+			vm := NewVM(tc.contract, crypto.Address{}, NewState())
 
-			_, err := vm.Run()
+			err := vm.Run()
 			require.Nil(t, err)
 
 			result := vm.stack.pop().([]byte)
@@ -172,9 +170,9 @@ func TestVMInstrArithmetics(t *testing.T) {
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			vm := NewVM(tc.contract, NewState())
+			vm := NewVM(tc.contract, crypto.Address{}, NewState())
 
-			_, err := vm.Run()
+			err := vm.Run()
 			require.Nil(t, err)
 
 			result, err := vm.toInt()
@@ -198,3 +196,186 @@ func TestVMStack(t *testing.T) {
 	require.Equal(t, value, 1)
 
 }
+
+func TestVMInstrCompareAndLogic(t *testing.T) {
+	testcases := []struct {
+		name   string
+		a, b   byte // b is pushed last
+		instr  Instruction
+		result uint64
+	}{
+		{name: "2==2", a: 2, b: 2, instr: InstrEq, result: 1},
+		{name: "2==1", a: 1, b: 2, instr: InstrEq, result: 0},
+		{name: "2<1", a: 1, b: 2, instr: InstrLt, result: 0},
+		{name: "1<2", a: 2, b: 1, instr: InstrLt, result: 1},
+		{name: "2>1", a: 1, b: 2, instr: InstrGt, result: 1},
+		{name: "1&&0", a: 1, b: 0, instr: InstrAnd, result: 0},
+		{name: "1&&2", a: 1, b: 2, instr: InstrAnd, result: 1},
+		{name: "0||2", a: 0, b: 2, instr: InstrOr, result: 1},
+		{name: "0||0", a: 0, b: 0, instr: InstrOr, result: 0},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			contract := []byte{tc.a, byte(InstrPushInt), tc.b, byte(InstrPushInt), byte(tc.instr)}
+			vm := NewVM(contract, crypto.Address{}, NewState())
+			require.Nil(t, vm.Run())
+			require.Equal(t, tc.result, vm.stack.pop())
+			require.Equal(t, 0, vm.stack.sp)
+		})
+	}
+
+	vm := NewVM([]byte{0x00, byte(InstrPushInt), byte(InstrNot)}, crypto.Address{}, NewState())
+	require.Nil(t, vm.Run())
+	require.Equal(t, uint64(1), vm.stack.pop())
+}
+
+func TestVMInstrJump(t *testing.T) {
+	contract := func(cond byte) []byte {
+		return []byte{
+			cond, byte(InstrPushInt),
+			0x09, 0x00, byte(InstrJumpIf),
+			0x07, byte(InstrPushInt),
+			byte(InstrLog),
+			byte(InstrHalt),
+			// offset 9
+			0x08, byte(InstrPushInt),
+			byte(InstrLog),
+		}
+	}
+
+	vm := NewVM(contract(1), crypto.Address{}, NewState())
+	require.Nil(t, vm.Run())
+	require.Equal(t, [][]byte{{8, 0, 0, 0, 0, 0, 0, 0}}, vm.Logs())
+
+	vm = NewVM(contract(0), crypto.Address{}, NewState())
+	require.Nil(t, vm.Run())
+	require.Equal(t, [][]byte{{7, 0, 0, 0, 0, 0, 0, 0}}, vm.Logs())
+
+	// loops run until gas is exhausted
+	vm = NewVMWithGas([]byte{0x00, 0x00, byte(InstrJump)}, crypto.Address{}, NewState(), 100)
+	require.Equal(t, ErrOutOfGas, vm.Run())
+	vm = NewVM([]byte{0x00, 0x00, byte(InstrJump)}, crypto.Address{}, NewState())
+	require.Equal(t, ErrOutOfGas, vm.Run())
+	require.Equal(t, defaultVMGas, vm.GasUsed())
+
+	// jumping into operands of an instruction is rejected
+	vm = NewVM([]byte{0x07, byte(InstrPushInt), 0x01, 0x00, byte(InstrJump)}, crypto.Address{}, NewState())
+	require.Equal(t, ErrJumpTargetNotValid, vm.Run())
+}
+
+func TestDecodeBytecode(t *testing.T) {
+	code, err := decodeBytecode(createStoreContract('a', 1))
+	require.Nil(t, err)
+	require.Equal(t, []int{1, 3, 4, 6, 7}, code.ops)
+
+	_, err = decodeBytecode([]byte{byte(InstrPushInt)})
+	require.Equal(t, ErrOperandMissing, err.Err)
+
+	code, err = decodeBytecode(nil)
+	require.Nil(t, err)
+	require.Empty(t, code.ops)
+}
+
+func TestVerifyBytecode(t *testing.T) {
+	jumps := []byte{
+		0x01, byte(InstrPushInt),
+		0x09, 0x00, byte(InstrJumpIf),
+		0x07, byte(InstrPushInt),
+		byte(InstrLog),
+		byte(InstrHalt),
+		0x08, byte(InstrPushInt),
+		byte(InstrLog),
+	}
+	require.Nil(t, VerifyBytecode(createStoreContract('a', 1)))
+	require.Nil(t, VerifyBytecode(jumps))
+	// loops keeping stack height are valid
+	require.Nil(t, VerifyBytecode([]byte{0x01, byte(InstrPushInt), byte(InstrLog), 0x00, 0x00, byte(InstrJump)}))
+
+	testcases := []struct {
+		name     string
+		contract []byte
+		offset   int
+		err      error
+	}{
+		{name: "empty", contract: nil, offset: 0, err: ErrBytecodeEmpty},
+		{name: "unknown", contract: []byte{0x01, byte(InstrPushInt), 0xff}, offset: 2, err: ErrInstructionUnknown},
+		{name: "operand", contract: []byte{byte(InstrPushInt)}, offset: 0, err: ErrOperandMissing},
+		{name: "target", contract: []byte{0x07, byte(InstrPushInt), 0x01, 0x00, byte(InstrJump)}, offset: 4, err: ErrJumpTargetNotValid},
+		{name: "underflow", contract: []byte{0x01, byte(InstrPushInt), byte(InstrAdd)}, offset: 2, err: ErrStackUnderflow},
+		{name: "str-underflow", contract: []byte{0x02, byte(InstrStrCreate), byte(InstrStrPack)}, offset: 2, err: ErrStackUnderflow},
+		{name: "loop", contract: []byte{0x01, byte(InstrPushInt), 0x00, 0x00, byte(InstrJump)}, offset: 4, err: ErrStackHeightMismatch},
+		{name: "branch", contract: []byte{0x01, byte(InstrPushInt), 0x07, 0x00, byte(InstrJumpIf), 0x01, byte(InstrPushInt), byte(InstrHalt)}, offset: 6, err: ErrStackHeightMismatch},
+		{name: "overflow", contract: []byte{
+			0x01, byte(InstrPushInt), 0x01, byte(InstrPushInt), 0xff, byte(InstrLoadRange),
+			0x01, byte(InstrPushInt), 0xff, byte(InstrLoadRange),
+			0x01, byte(InstrPushInt), 0xff, byte(InstrLoadRange),
+		}, offset: 13, err: ErrStackOverflow},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifyBytecode(tc.contract)
+			var berr *BytecodeError
+			require.True(t, errors.As(err, &berr))
+			require.Equal(t, tc.offset, berr.Offset)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestVMFaults(t *testing.T) {
+	testcases := []struct {
+		name     string
+		contract []byte
+		err      error
+	}{
+		{name: "empty", contract: nil, err: ErrBytecodeEmpty},
+		{name: "missing-operand", contract: []byte{byte(InstrPushInt)}, err: ErrOperandMissing},
+		{name: "unknown", contract: []byte{0x01}, err: ErrInstructionUnknown},
+		{name: "underflow", contract: []byte{0x01, byte(InstrPushInt), byte(InstrAdd)}, err: ErrStackUnderflow},
+		{name: "str-underflow", contract: []byte{0x02, byte(InstrStrCreate), byte(InstrStrPack)}, err: ErrStackUnderflow},
+		{name: "overflow", contract: []byte{0x01, byte(InstrPushInt), 0x00, 0x00, byte(InstrJump)}, err: ErrStackOverflow},
+		{name: "key-type", contract: []byte{0x01, byte(InstrPushInt), 0x01, byte(InstrPushInt), byte(InstrStore)}, err: ErrOperandType},
+		{name: "int-type", contract: []byte{0x00, byte(InstrStrCreate), byte(InstrStrPack), byte(InstrNot)}, err: ErrOperandType},
+		{name: "str-type", contract: []byte{0x00, byte(InstrStrCreate), byte(InstrStrPack), 0x01, byte(InstrStrCreate), byte(InstrStrPack)}, err: ErrOperandType},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := NewVMWithGas(tc.contract, crypto.Address{}, NewState(), 100_000).Run()
+			require.Equal(t, tc.err, err)
+		})
+	}
+}
+
+func TestBlockChainFaultingTransaction(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := NewBlockChain()
+	require.Nil(t, err)
+
+	// storing under an integer key passes verification but faults when run
+	tx := createSignedTransaction(t, []byte{0x01, byte(InstrPushInt), 0x01, byte(InstrPushInt), byte(InstrStore)})
+	_, err = bc.CreateBlock(kp, []*Transaction{tx})
+	require.Nil(t, err)
+
+	receipt, err := bc.GetReceipt(tx.Hash())
+	require.Nil(t, err)
+	require.Equal(t, ReceiptFailed, receipt.Status)
+	require.Equal(t, ErrOperandType.Error(), receipt.Error)
+
+	// transactions failing verification are left out of blocks
+	invalid := createSignedTransaction(t, []byte{byte(InstrAdd)})
+	_, err = bc.CreateBlock(kp, []*Transaction{invalid})
+	require.Nil(t, err)
+	_, err = bc.GetReceipt(invalid.Hash())
+	require.Equal(t, ErrTxNotFound, err)
+
+	// and blocks including them are rejected
+	b, err := NewBlock(bc.CurrentHeader(), []*Transaction{invalid})
+	require.Nil(t, err)
+	require.Nil(t, b.Sign(kp))
+	require.ErrorIs(t, bc.AddBlock(b), ErrStackUnderflow)
+}
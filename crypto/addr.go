@@ -2,8 +2,11 @@ package crypto
 
 import (
 	"encoding/hex"
+	"errors"
 )
 
+var ErrInvalidAddress = errors.New("invalid address")
+
 const size = 20
 
 type Address [size]byte
@@ -29,3 +32,25 @@ func AddressFromBytes(b []byte) Address {
 
 	return Address(data)
 }
+
+// AddressFromHex parses hex encoded address.
+func AddressFromHex(s string) (Address, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != size {
+		return Address{}, ErrInvalidAddress
+	}
+	return AddressFromBytes(b), nil
+}
+
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Address) UnmarshalText(b []byte) error {
+	addr, err := AddressFromHex(string(b))
+	if err != nil {
+		return err
+	}
+	*a = addr
+	return nil
+}
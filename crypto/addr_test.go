@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressFromHex(t *testing.T) {
+	key, err := GenerateKeyPair()
+	require.Nil(t, err)
+
+	addr, err := AddressFromHex(key.Address().String())
+	require.Nil(t, err)
+	require.Equal(t, key.Address(), addr)
+
+	_, err = AddressFromHex("abcd")
+	require.Equal(t, ErrInvalidAddress, err)
+	_, err = AddressFromHex("not hex")
+	require.Equal(t, ErrInvalidAddress, err)
+}
+
+func TestAddressJSON(t *testing.T) {
+	key, err := GenerateKeyPair()
+	require.Nil(t, err)
+
+	balances := map[Address]uint64{key.Address(): 10}
+	data, err := json.Marshal(balances)
+	require.Nil(t, err)
+
+	decoded := map[Address]uint64{}
+	require.Nil(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, balances, decoded)
+}
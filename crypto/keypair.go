@@ -4,7 +4,12 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"io"
+	"math/big"
+	"os"
+	"strings"
 
 	"github.com/igumus/chainx/hash"
 )
@@ -23,6 +28,55 @@ func GenerateKeyPairFromReader(r io.Reader) (*KeyPair, error) {
 	}, nil
 }
 
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
+// KeyPairFromPrivateKey restores key pair from bytes returned by
+// KeyPair.PrivateKey.
+func KeyPairFromPrivateKey(b []byte) (*KeyPair, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(b)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(b)
+	return &KeyPair{
+		privKey: key,
+	}, nil
+}
+
+// LoadOrCreateKeyPair reads hex encoded private key from given file. If
+// the file does not exist, a new key is generated and written to it. A
+// random key is returned, without being written, if path is empty.
+func LoadOrCreateKeyPair(path string) (*KeyPair, error) {
+	if len(path) == 0 {
+		return GenerateKeyPair()
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		b, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		return KeyPairFromPrivateKey(b)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.PrivateKey())), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 type KeyPair struct {
 	privKey *ecdsa.PrivateKey
 }
@@ -32,6 +86,12 @@ func (p *KeyPair) publicKey() []byte {
 	return elliptic.MarshalCompressed(pkey, pkey.X, pkey.Y)
 }
 
+// PrivateKey returns the private scalar of the key pair, it must be
+// kept secret.
+func (p *KeyPair) PrivateKey() []byte {
+	return p.privKey.D.FillBytes(make([]byte, 32))
+}
+
 func (p *KeyPair) Address() Address {
 	h := hash.CreateHash(p.publicKey())
 	return AddressFromBytes(h)
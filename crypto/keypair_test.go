@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -57,3 +58,48 @@ func TestKeyPairSign(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyPairFromPrivateKey(t *testing.T) {
+	key, err := GenerateKeyPair()
+	require.Nil(t, err)
+
+	restored, err := KeyPairFromPrivateKey(key.PrivateKey())
+	require.Nil(t, err)
+	require.Equal(t, key.Address(), restored.Address())
+
+	signature, err := restored.Sign([]byte("hello world"))
+	require.Nil(t, err)
+	require.Nil(t, signature.Verify([]byte("hello world")))
+	require.Equal(t, key.Address(), signature.Address())
+
+	_, err = KeyPairFromPrivateKey(make([]byte, 32))
+	require.Equal(t, ErrInvalidPrivateKey, err)
+}
+
+func TestLoadOrCreateKeyPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.key")
+
+	created, err := LoadOrCreateKeyPair(path)
+	require.Nil(t, err)
+	loaded, err := LoadOrCreateKeyPair(path)
+	require.Nil(t, err)
+	require.Equal(t, created.Address(), loaded.Address())
+
+	random, err := LoadOrCreateKeyPair("")
+	require.Nil(t, err)
+	require.NotEqual(t, created.Address(), random.Address())
+}
+
+func TestSignatureMalformedPublicKey(t *testing.T) {
+	key, err := GenerateKeyPair()
+	require.Nil(t, err)
+	signature, err := key.Sign([]byte("hello world"))
+	require.Nil(t, err)
+	require.Nil(t, ValidatePublicKey(signature.PubKey))
+
+	signature.PubKey = []byte{1, 2, 3}
+	require.Equal(t, ErrInvalidPublicKey, ValidatePublicKey(signature.PubKey))
+	require.Equal(t, ErrInvalidSignature, signature.Verify([]byte("hello world")))
+
+	require.Equal(t, ErrInvalidSignature, (&Signature{PubKey: key.publicKey()}).Verify([]byte("hello world")))
+}
@@ -7,11 +7,14 @@ import (
 	"encoding/hex"
 	"errors"
 	"math/big"
+
+	"github.com/igumus/chainx/hash"
 )
 
 var (
 	ErrNoSignature      = errors.New("signature not found")
 	ErrInvalidSignature = errors.New("signature is invalid")
+	ErrInvalidPublicKey = errors.New("public key is invalid")
 )
 
 type Signature struct {
@@ -20,11 +23,26 @@ type Signature struct {
 	PubKey []byte
 }
 
+// ValidatePublicKey checks that given bytes are a compressed public key
+// on the curve used by key pairs.
+func ValidatePublicKey(b []byte) error {
+	if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), b); x == nil {
+		return ErrInvalidPublicKey
+	}
+	return nil
+}
+
 func (s *Signature) Verify(data []byte) error {
 	if s == nil {
 		return ErrNoSignature
 	}
+	if s.R == nil || s.S == nil {
+		return ErrInvalidSignature
+	}
 	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), s.PubKey)
+	if x == nil {
+		return ErrInvalidSignature
+	}
 	key := &ecdsa.PublicKey{
 		Curve: elliptic.P256(),
 		X:     x,
@@ -50,3 +68,9 @@ func (s *Signature) Bytes() []byte {
 func (s *Signature) String() string {
 	return hex.EncodeToString(s.Bytes())
 }
+
+// Address returns address of the key pair which created the signature.
+func (s *Signature) Address() Address {
+	h := hash.CreateHash(s.PubKey)
+	return AddressFromBytes(h)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"errors"
+	"sync/atomic"
 )
 
 type HashAlgorithm byte
@@ -22,6 +23,45 @@ const (
 
 var ErrUnknownHashAlgorithm = errors.New("unknown hash algorithm")
 
+var algorithmNames = map[HashAlgorithm]string{
+	Sha1:     "sha1",
+	Sha2_256: "sha2-256",
+	Sha2_512: "sha2-512",
+}
+
+func (a HashAlgorithm) String() string {
+	if name, ok := algorithmNames[a]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseAlgorithm returns hash algorithm with given name (e.g. sha2-256).
+func ParseAlgorithm(name string) (HashAlgorithm, error) {
+	for alg, n := range algorithmNames {
+		if n == name {
+			return alg, nil
+		}
+	}
+	return identity, ErrUnknownHashAlgorithm
+}
+
+func (a HashAlgorithm) MarshalText() ([]byte, error) {
+	if a.isUnknown() {
+		return nil, ErrUnknownHashAlgorithm
+	}
+	return []byte(a.String()), nil
+}
+
+func (a *HashAlgorithm) UnmarshalText(b []byte) error {
+	alg, err := ParseAlgorithm(string(b))
+	if err != nil {
+		return err
+	}
+	*a = alg
+	return nil
+}
+
 func algorithmFactory(v byte) HashAlgorithm {
 	switch v {
 	case byte(Sha1):
@@ -37,7 +77,34 @@ func algorithmFactory(v byte) HashAlgorithm {
 
 type hashFunc func([]byte) []byte
 
-var defaultHasher hashFunc = hasherFactory(Sha2_256)
+// hashing is the default algorithm together with its hasher, they are
+// swapped at once so readers never see one without the other.
+type hashing struct {
+	algorithm HashAlgorithm
+	hasher    hashFunc
+}
+
+var defaultHashing atomic.Pointer[hashing]
+
+func init() {
+	defaultHashing.Store(&hashing{algorithm: Sha2_256, hasher: hasherFactory(Sha2_256)})
+}
+
+// DefaultAlgorithm returns algorithm used by CreateHash.
+func DefaultAlgorithm() HashAlgorithm {
+	return defaultHashing.Load().algorithm
+}
+
+// SetDefaultAlgorithm changes algorithm used by CreateHash. It is meant
+// to be called once at startup, before any hash is created.
+func SetDefaultAlgorithm(alg HashAlgorithm) error {
+	hasher := hasherFactory(alg)
+	if hasher == nil {
+		return ErrUnknownHashAlgorithm
+	}
+	defaultHashing.Store(&hashing{algorithm: alg, hasher: hasher})
+	return nil
+}
 
 func hasherFactory(alg HashAlgorithm) hashFunc {
 	switch alg {
@@ -0,0 +1,64 @@
+package hash
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	for _, alg := range []HashAlgorithm{Sha1, Sha2_256, Sha2_512} {
+		parsed, err := ParseAlgorithm(alg.String())
+		require.Nil(t, err)
+		require.Equal(t, alg, parsed)
+	}
+
+	_, err := ParseAlgorithm("md5")
+	require.Equal(t, ErrUnknownHashAlgorithm, err)
+}
+
+func TestAlgorithmJSON(t *testing.T) {
+	data, err := json.Marshal(Sha2_512)
+	require.Nil(t, err)
+	require.Equal(t, `"sha2-512"`, string(data))
+
+	var alg HashAlgorithm
+	require.Nil(t, json.Unmarshal(data, &alg))
+	require.Equal(t, Sha2_512, alg)
+}
+
+func TestSetDefaultAlgorithm(t *testing.T) {
+	defer SetDefaultAlgorithm(Sha2_256)
+
+	require.Equal(t, ErrUnknownHashAlgorithm, SetDefaultAlgorithm(identity))
+	require.Equal(t, Sha2_256, DefaultAlgorithm())
+
+	require.Nil(t, SetDefaultAlgorithm(Sha2_512))
+	h := CreateHash([]byte("hello world"))
+	require.Equal(t, byte(Sha2_512), h[1])
+}
+
+func TestSetDefaultAlgorithmConcurrently(t *testing.T) {
+	defer SetDefaultAlgorithm(Sha2_256)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			SetDefaultAlgorithm(Sha2_512)
+			SetDefaultAlgorithm(Sha1)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		h := CreateHash([]byte("hello world"))
+		require.Nil(t, h.Verify([]byte("hello world")))
+	}
+	<-done
+
+	// digest of the fallback follows the default algorithm too
+	require.Nil(t, SetDefaultAlgorithm(Sha2_512))
+	h := createHash(version_1, identity, []byte("hello world"))
+	require.Len(t, h.Digest(), 64)
+	require.Equal(t, Sha2_512, CreateHash(nil).Algorithm())
+}
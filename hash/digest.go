@@ -7,15 +7,18 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// hash header is version, algorithm and digest length
+const hashHeaderSize = 3
+
 func createHash(v hashVersion, alg HashAlgorithm, data []byte) Hash {
 	var hasher hashFunc = nil
 
 	hasher = hasherFactory(alg)
 	if hasher == nil {
 		if e := log.Logger.Debug(); e.Enabled() {
-			log.Debug().Msg("unknown hash algorithm using default sha256")
+			log.Debug().Msg("unknown hash algorithm using default algorithm")
 		}
-		hasher = defaultHasher
+		hasher = defaultHashing.Load().hasher
 	}
 
 	digest := hasher(data)
@@ -30,7 +33,7 @@ func createHash(v hashVersion, alg HashAlgorithm, data []byte) Hash {
 }
 
 func CreateHash(data []byte) Hash {
-	return CreateHashWith(Sha2_256, data)
+	return CreateHashWith(DefaultAlgorithm(), data)
 }
 
 func CreateHashWith(alg HashAlgorithm, data []byte) Hash {
@@ -0,0 +1,123 @@
+package hash
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	ErrMerkleLeafNotFound      = errors.New("leaf not found in merkle tree")
+	ErrMerkleProofNotVerified  = errors.New("merkle proof not verified")
+	ErrMerkleProofIndexInvalid = errors.New("merkle proof index is invalid")
+)
+
+// domain separation prefixes, so an inner node can never be presented as
+// a leaf (and vice versa)
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+func merkleLeaf(leaf Hash) Hash {
+	return CreateHash(bytes.Join([][]byte{{merkleLeafPrefix}, leaf.Bytes()}, []byte{}))
+}
+
+func merkleNode(left, right Hash) Hash {
+	return CreateHash(bytes.Join([][]byte{{merkleNodePrefix}, left.Bytes(), right.Bytes()}, []byte{}))
+}
+
+// merkleLevels builds every level of the tree, from hashed leaves up to
+// the root. A node without a sibling is promoted to the next level as is.
+func merkleLevels(leaves []Hash) [][]Hash {
+	level := make([]Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeaf(leaf)
+	}
+
+	levels := [][]Hash{level}
+	for len(level) > 1 {
+		next := make([]Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// MerkleRoot calculates root of the merkle tree built over given leaves.
+// Root of an empty tree is ZeroHash.
+func MerkleRoot(leaves []Hash) Hash {
+	if len(leaves) == 0 {
+		return ZeroHash
+	}
+	levels := merkleLevels(leaves)
+	return levels[len(levels)-1][0]
+}
+
+// MerkleStep is a single sibling on the path from a leaf to the root.
+type MerkleStep struct {
+	Hash Hash
+	Left bool // sibling is the left child
+}
+
+// MerkleProof proves inclusion of the leaf at Index in a merkle tree.
+type MerkleProof struct {
+	Index uint32
+	Path  []MerkleStep
+}
+
+// NewMerkleProof creates inclusion proof of the leaf at given index.
+func NewMerkleProof(leaves []Hash, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, ErrMerkleProofIndexInvalid
+	}
+
+	proof := &MerkleProof{
+		Index: uint32(index),
+		Path:  []MerkleStep{},
+	}
+
+	levels := merkleLevels(leaves)
+	pos := index
+	for _, level := range levels[:len(levels)-1] {
+		if pos%2 == 1 {
+			proof.Path = append(proof.Path, MerkleStep{Hash: level[pos-1], Left: true})
+		} else if pos+1 < len(level) {
+			proof.Path = append(proof.Path, MerkleStep{Hash: level[pos+1], Left: false})
+		}
+		pos = pos / 2
+	}
+	return proof, nil
+}
+
+// NewMerkleProofFor creates inclusion proof of the given leaf.
+func NewMerkleProofFor(leaves []Hash, leaf Hash) (*MerkleProof, error) {
+	for i, l := range leaves {
+		if l.IsEqual(leaf) {
+			return NewMerkleProof(leaves, i)
+		}
+	}
+	return nil, ErrMerkleLeafNotFound
+}
+
+// Verify checks that given leaf is included in the tree with given root.
+func (p *MerkleProof) Verify(root Hash, leaf Hash) error {
+	current := merkleLeaf(leaf)
+	for _, step := range p.Path {
+		if step.Left {
+			current = merkleNode(step.Hash, current)
+		} else {
+			current = merkleNode(current, step.Hash)
+		}
+	}
+	if !current.IsEqual(root) {
+		return ErrMerkleProofNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package hash
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createLeaves(size int) []Hash {
+	leaves := make([]Hash, size)
+	for i := 0; i < size; i++ {
+		leaves[i] = CreateHash([]byte(fmt.Sprintf("leaf_%d", i)))
+	}
+	return leaves
+}
+
+func TestMerkleRootEmpty(t *testing.T) {
+	require.True(t, MerkleRoot(nil).IsZero())
+}
+
+func TestMerkleRootChangesWithLeaves(t *testing.T) {
+	leaves := createLeaves(4)
+	root := MerkleRoot(leaves)
+	require.False(t, root.IsZero())
+
+	swapped := []Hash{leaves[1], leaves[0], leaves[2], leaves[3]}
+	require.False(t, root.IsEqual(MerkleRoot(swapped)))
+	require.False(t, root.IsEqual(MerkleRoot(leaves[:3])))
+}
+
+func TestMerkleProof(t *testing.T) {
+	for _, size := range []int{1, 2, 3, 5, 8, 13} {
+		t.Run(fmt.Sprintf("leaves-%d", size), func(t *testing.T) {
+			leaves := createLeaves(size)
+			root := MerkleRoot(leaves)
+
+			for i, leaf := range leaves {
+				proof, err := NewMerkleProof(leaves, i)
+				require.Nil(t, err)
+				require.Nil(t, proof.Verify(root, leaf))
+				require.Equal(t, ErrMerkleProofNotVerified, proof.Verify(root, CreateHash([]byte("foo"))))
+			}
+		})
+	}
+}
+
+func TestMerkleProofFor(t *testing.T) {
+	leaves := createLeaves(5)
+
+	proof, err := NewMerkleProofFor(leaves, leaves[3])
+	require.Nil(t, err)
+	require.Equal(t, uint32(3), proof.Index)
+	require.Nil(t, proof.Verify(MerkleRoot(leaves), leaves[3]))
+
+	_, err = NewMerkleProofFor(leaves, CreateHash([]byte("foo")))
+	require.Equal(t, ErrMerkleLeafNotFound, err)
+
+	_, err = NewMerkleProof(leaves, 5)
+	require.Equal(t, ErrMerkleProofIndexInvalid, err)
+}
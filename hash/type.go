@@ -45,3 +45,43 @@ func (h Hash) Verify(data []byte) error {
 
 	return nil
 }
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes hex encoded hash, empty text decodes to ZeroHash.
+func (h *Hash) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*h = ZeroHash
+		return nil
+	}
+	decoded, err := FromHexString(string(b))
+	if err != nil {
+		return err
+	}
+	*h = decoded
+	return nil
+}
+
+// Digest returns the digest of the hash without version and algorithm
+// header.
+func (h Hash) Digest() []byte {
+	if len(h) < hashHeaderSize {
+		return nil
+	}
+	return h[hashHeaderSize:]
+}
+
+// Algorithm returns algorithm the hash is created with, or an unknown
+// algorithm for a malformed hash.
+func (h Hash) Algorithm() HashAlgorithm {
+	if len(h) < hashHeaderSize {
+		return identity
+	}
+	_, alg, err := decode(h)
+	if err != nil {
+		return identity
+	}
+	return alg
+}
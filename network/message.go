@@ -2,7 +2,9 @@ package network
 
 import (
 	"bytes"
-	"encoding/gob"
+	"errors"
+
+	"github.com/igumus/chainx/core"
 )
 
 type RemoteMessageHandler interface {
@@ -26,28 +28,42 @@ const (
 	ChainBlock           MessageType = 0x9
 	ChainFetchBlock      MessageType = 0xa
 	ChainFetchBlockReply MessageType = 0xb
+	ChainTxRejected      MessageType = 0xc
 )
 
-func Decode(payload []byte, msg any) error {
-	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(msg); err != nil {
-		return err
-	}
-	return nil
-}
+var ErrMessageMalformed = errors.New("malformed message")
 
 type RemoteMessage struct {
-	From    PeerID
+	From PeerID
+	// codec negotiated with the sender, default codec is used if nil
+	Codec   core.Codec
 	Payload []byte
 }
 
+// Decode decodes message envelope of the remote message payload.
+func (r RemoteMessage) Decode() (*Message, error) {
+	return DecodeMessage(r.Payload)
+}
+
+// DecodeData decodes data of given message with the codec of the sender.
+func (r RemoteMessage) DecodeData(msg *Message, v any) error {
+	codec := r.Codec
+	if codec == nil {
+		codec = core.DefaultCodec
+	}
+	return codec.Decode(bytes.NewReader(msg.Data), v)
+}
+
 type Message struct {
 	Header MessageType
 	Data   []byte
 }
 
-func NewMessage(mt MessageType, data any) (*Message, error) {
+// NewMessage creates message of given type, with data encoded by given
+// codec.
+func NewMessage(mt MessageType, data any, codec core.Codec) (*Message, error) {
 	buf := new(bytes.Buffer)
-	if err := gob.NewEncoder(buf).Encode(data); err != nil {
+	if err := codec.Encode(buf, data); err != nil {
 		return nil, err
 	}
 	return &Message{
@@ -56,10 +72,20 @@ func NewMessage(mt MessageType, data any) (*Message, error) {
 	}, nil
 }
 
+// Bytes returns wire format of the message, which is the message type
+// byte followed by message data. It does not depend on any codec, so
+// messages can be framed before a codec is negotiated.
 func (m *Message) Bytes() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	if err := gob.NewEncoder(buf).Encode(m); err != nil {
-		return nil, err
+	return append([]byte{byte(m.Header)}, m.Data...), nil
+}
+
+// DecodeMessage decodes wire format of a message.
+func DecodeMessage(b []byte) (*Message, error) {
+	if len(b) == 0 {
+		return nil, ErrMessageMalformed
 	}
-	return buf.Bytes(), nil
+	return &Message{
+		Header: MessageType(b[0]),
+		Data:   b[1:],
+	}, nil
 }
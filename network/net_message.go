@@ -2,51 +2,39 @@ package network
 
 import (
 	"bytes"
-	"encoding/gob"
+	"encoding/json"
 )
 
+// handshake messages are always json encoded, since codec of the peer is
+// only known once handshake completes
+
 type networkHandshakeMessage struct {
-	Id   string
-	Addr string
+	Id      string
+	Addr    string
+	Genesis string
+	// supported codec names in preference order
+	Codecs []string
 }
 
 func decodeHandshakeMessage(data []byte) (*networkHandshakeMessage, error) {
 	msg := &networkHandshakeMessage{}
-	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(msg); err != nil {
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(msg); err != nil {
 		return nil, err
 	}
 	return msg, nil
 }
 
 type networkHandshakeReplyMessage struct {
-	Id   string
-	Addr string
-}
-
-func (n *networkHandshakeReplyMessage) encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	if err := gob.NewEncoder(buf).Encode(n); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
-}
-
-func (n *networkHandshakeReplyMessage) message() ([]byte, error) {
-	data, err := n.encode()
-	if err != nil {
-		return nil, err
-	}
-	msg := &Message{
-		Header: NetworkHandshakeReply,
-		Data:   data,
-	}
-
-	return msg.Bytes()
+	Id      string
+	Addr    string
+	Genesis string
+	// codec chosen from codecs of the handshake message
+	Codec string
 }
 
 func decodeHandshakeReplyMessage(data []byte) (*networkHandshakeReplyMessage, error) {
 	msg := &networkHandshakeReplyMessage{}
-	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(msg); err != nil {
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(msg); err != nil {
 		return nil, err
 	}
 	return msg, nil
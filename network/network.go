@@ -1,16 +1,23 @@
 package network
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/igumus/chainx/core"
 	"github.com/igumus/chainx/crypto"
 	"github.com/rs/zerolog"
 )
 
+var (
+	ErrGenesisMismatch = errors.New("peer genesis does not match")
+	ErrNoCommonCodec   = errors.New("peer does not support any codec")
+)
+
 type Network interface {
 	ID() string
 	Name() string
@@ -18,7 +25,7 @@ type Network interface {
 	Dial(addr string) (string, error)
 	Consume() <-chan RemoteMessage
 	Send(PeerID, MessageType, any) error
-	Broadcast(*Message, PeerID) error
+	Broadcast(MessageType, any, PeerID) error
 	io.Closer
 	RemoteMessageHandler
 }
@@ -28,6 +35,8 @@ type network struct {
 	name      string
 	debug     bool
 	keypair   *crypto.KeyPair
+	genesis   string
+	codecs    []core.Codec
 	logger    zerolog.Logger
 	seedNodes []string
 	transport Transport
@@ -53,6 +62,8 @@ func New(options ...NetworkOption) (Network, error) {
 		debug:        config.debug,
 		logger:       config.logger,
 		keypair:      config.keypair,
+		genesis:      config.genesis,
+		codecs:       config.codecs,
 		id:           config.id,
 		name:         config.name,
 		seedNodes:    config.nodes,
@@ -132,18 +143,18 @@ func (n *network) processPeerLeave(peer Peer) {
 }
 
 func (n *network) HandleMessage(rpc RemoteMessage) error {
-	message := &Message{}
-	if err := Decode(rpc.Payload, message); err != nil {
+	message, err := rpc.Decode()
+	if err != nil {
 		return err
 	}
 
 	switch message.Header {
 	case NetworkHandshake:
 		n.logger.Info().Str("from", rpc.From.String()).Msg("received new handshake message")
-		return n.processPeerHandshake(rpc.From, message.Data, false)
+		return n.processPeerHandshake(rpc.From, message.Data)
 	case NetworkHandshakeReply:
 		n.logger.Info().Str("from", rpc.From.String()).Msg("received handshake reply message")
-		return n.processPeerHandshake(rpc.From, message.Data, true)
+		return n.processPeerHandshakeReply(rpc.From, message.Data)
 	case NetworkReserved_2:
 		n.logger.Warn().Str("from", rpc.From.String()).Str("type", "NetworkReserved_2").Msg("unhandled network message")
 		return nil
@@ -165,19 +176,22 @@ func (n *network) HandleMessage(rpc RemoteMessage) error {
 	}
 }
 
-func (n *network) processPeerHandshake(from PeerID, rawHandshakeData []byte, reply bool) error {
-	msg := &networkHandshakeMessage{}
-	if err := Decode(rawHandshakeData, msg); err != nil {
-		return err
-	}
-
+// pendingPeer returns peer with given id, which has not completed
+// handshake yet.
+func (n *network) pendingPeer(from PeerID) (*peer, error) {
 	n.pendingLock.RLock()
+	defer n.pendingLock.RUnlock()
 	peer, ok := n.pendingPeers[from]
-	n.pendingLock.RUnlock()
 	if !ok {
-		return fmt.Errorf("handshaking failed with unknown pending peer: %s", from)
+		return nil, fmt.Errorf("handshaking failed with unknown pending peer: %s", from)
 	}
-	peer.handshake(msg.Id)
+	return peer, nil
+}
+
+// acceptPeer completes handshake of the pending peer, messages are
+// encoded with the given codec from now on.
+func (n *network) acceptPeer(from PeerID, peer *peer, id string, codec core.Codec) {
+	peer.handshake(id, codec)
 
 	n.pendingLock.Lock()
 	delete(n.pendingPeers, from)
@@ -187,23 +201,106 @@ func (n *network) processPeerHandshake(from PeerID, rawHandshakeData []byte, rep
 	n.lock.Lock()
 	n.peers[peer.ID()] = peer
 	n.lock.Unlock()
+}
 
-	if reply {
-		n.logger.Info().Str("toNet", peer.ID().String()).Msg("full handshake established")
-		return nil
+// rejectPeer drops the pending peer and closes its connection.
+func (n *network) rejectPeer(from PeerID, peer *peer, reason error) error {
+	n.pendingLock.Lock()
+	delete(n.pendingPeers, from)
+	n.pendingLock.Unlock()
+	n.logger.Warn().
+		Err(reason).
+		Str("peerAddr", peer.Addr()).
+		Msg("rejecting peer")
+	if err := peer.Close(); err != nil {
+		return err
+	}
+	return reason
+}
+
+// selectCodec returns the first of given codec names, which is also
+// supported by this network.
+func (n *network) selectCodec(names []string) core.Codec {
+	for _, name := range names {
+		for _, codec := range n.codecs {
+			if codec.Name() == name {
+				return codec
+			}
+		}
+	}
+	return nil
+}
+
+func (n *network) codecNames() []string {
+	names := make([]string, len(n.codecs))
+	for i, codec := range n.codecs {
+		names[i] = codec.Name()
+	}
+	return names
+}
+
+func (n *network) processPeerHandshake(from PeerID, data []byte) error {
+	msg, err := decodeHandshakeMessage(data)
+	if err != nil {
+		return err
+	}
+
+	peer, err := n.pendingPeer(from)
+	if err != nil {
+		return err
+	}
+
+	if msg.Genesis != n.genesis {
+		return n.rejectPeer(from, peer, ErrGenesisMismatch)
+	}
+
+	// codec preference of the dialing peer wins
+	codec := n.selectCodec(msg.Codecs)
+	if codec == nil {
+		return n.rejectPeer(from, peer, ErrNoCommonCodec)
 	}
 
 	replyMsg, err := NewMessage(NetworkHandshakeReply, networkHandshakeReplyMessage{
-		Id:   n.ID(),
-		Addr: n.transport.Addr(),
-	})
+		Id:      n.ID(),
+		Addr:    n.transport.Addr(),
+		Genesis: n.genesis,
+		Codec:   codec.Name(),
+	}, core.JSONCodec)
 	if err != nil {
 		return err
 	}
 
+	n.acceptPeer(from, peer, msg.Id, codec)
+	n.logger.Info().Str("toNet", peer.ID().String()).Str("codec", codec.Name()).Msg("handshake accepted")
+
 	return peer.Send(replyMsg)
 }
 
+func (n *network) processPeerHandshakeReply(from PeerID, data []byte) error {
+	msg, err := decodeHandshakeReplyMessage(data)
+	if err != nil {
+		return err
+	}
+
+	peer, err := n.pendingPeer(from)
+	if err != nil {
+		return err
+	}
+
+	if msg.Genesis != n.genesis {
+		return n.rejectPeer(from, peer, ErrGenesisMismatch)
+	}
+
+	codec := n.selectCodec([]string{msg.Codec})
+	if codec == nil {
+		return n.rejectPeer(from, peer, ErrNoCommonCodec)
+	}
+
+	n.acceptPeer(from, peer, msg.Id, codec)
+	n.logger.Info().Str("toNet", peer.ID().String()).Str("codec", codec.Name()).Msg("full handshake established")
+	return nil
+}
+
 func (n *network) Start() {
 	n.transport.Listen()
 	go n.process()
@@ -235,9 +332,11 @@ func (n *network) Dial(addr string) (string, error) {
 	time.Sleep(1 * time.Second)
 
 	handshake, err := NewMessage(NetworkHandshake, networkHandshakeMessage{
-		Id:   n.ID(),
-		Addr: n.transport.Addr(),
-	})
+		Id:      n.ID(),
+		Addr:    n.transport.Addr(),
+		Genesis: n.genesis,
+		Codecs:  n.codecNames(),
+	}, core.JSONCodec)
 	if err != nil {
 		return "", err
 	}
@@ -262,11 +361,6 @@ func (n *network) Close() error {
 }
 
 func (n *network) Send(to PeerID, mtype MessageType, data any) error {
-	msg, err := NewMessage(mtype, data)
-	if err != nil {
-		return err
-	}
-
 	n.lock.RLock()
 	defer n.lock.RUnlock()
 
@@ -275,29 +369,48 @@ func (n *network) Send(to PeerID, mtype MessageType, data any) error {
 		// TODO (@igumus): maybe we should include peer searching mechanism
 		return fmt.Errorf("unknown peer: %s", to)
 	}
-	return peer.Send(msg)
-}
 
-func (n *network) Broadcast(msg *Message, sender PeerID) error {
-	dmsg, err := msg.Bytes()
+	msg, err := NewMessage(mtype, data, peer.messageCodec())
 	if err != nil {
 		return err
 	}
+	return peer.Send(msg)
+}
 
+// Broadcast sends given data to every peer except the sender. Data is
+// encoded once per codec used by peers.
+func (n *network) Broadcast(mtype MessageType, data any, sender PeerID) error {
 	n.lock.RLock()
 	defer n.lock.RUnlock()
+
+	encoded := make(map[string][]byte)
 	for id, peer := range n.peers {
-		if id != sender {
-			go func(p Peer) {
-				if err := p.SendRaw(dmsg); err != nil {
-					n.logger.Error().Str("peer", p.ID().String()).Err(err).Msg("sending broadcast message failed")
-					return
-				}
-				if n.debug {
-					n.logger.Debug().Str("peer", p.ID().String()).Uint8("header", uint8(msg.Header)).Msg("broadcasted message")
-				}
-			}(peer)
+		if id == sender {
+			continue
 		}
+
+		codec := peer.messageCodec()
+		dmsg, ok := encoded[codec.Name()]
+		if !ok {
+			msg, err := NewMessage(mtype, data, codec)
+			if err != nil {
+				return err
+			}
+			if dmsg, err = msg.Bytes(); err != nil {
+				return err
+			}
+			encoded[codec.Name()] = dmsg
+		}
+
+		go func(p Peer, dmsg []byte) {
+			if err := p.SendRaw(dmsg); err != nil {
+				n.logger.Error().Str("peer", p.ID().String()).Err(err).Msg("sending broadcast message failed")
+				return
+			}
+			if n.debug {
+				n.logger.Debug().Str("peer", p.ID().String()).Uint8("header", uint8(mtype)).Msg("broadcasted message")
+			}
+		}(peer, dmsg)
 	}
 	return nil
 }
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"strings"
 
+	"github.com/igumus/chainx/core"
 	"github.com/igumus/chainx/crypto"
+	"github.com/igumus/chainx/hash"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -31,6 +33,13 @@ type netOptions struct {
 	logger zerolog.Logger
 	// network identifier
 	id string
+	// hex encoded genesis block hash, peers with different genesis are
+	// rejected during handshake
+	genesis string
+	// names of supported codecs in preference order
+	codecNames []string
+	// supported codecs, resolved from codec names
+	codecs []core.Codec
 }
 
 func createOptions(opts ...NetworkOption) (*netOptions, error) {
@@ -42,6 +51,8 @@ func createOptions(opts ...NetworkOption) (*netOptions, error) {
 		nodes:        nil,
 		keypair:      nil,
 		id:           "",
+		genesis:      "",
+		codecNames:   nil,
 	}
 
 	for _, opt := range opts {
@@ -54,6 +65,18 @@ func createOptions(opts ...NetworkOption) (*netOptions, error) {
 
 	cfg.id = cfg.keypair.Address().String()
 
+	// every known codec is supported if not specified
+	if len(cfg.codecNames) == 0 {
+		cfg.codecs = core.Codecs()
+	}
+	for _, name := range cfg.codecNames {
+		codec, err := core.LookupCodec(name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.codecs = append(cfg.codecs, codec)
+	}
+
 	if len(cfg.name) == 0 {
 		cfg.name = cfg.id
 	}
@@ -113,3 +136,20 @@ func WithDebugMode(b bool) NetworkOption {
 		no.debug = b
 	}
 }
+
+func WithGenesisHash(h hash.Hash) NetworkOption {
+	return func(no *netOptions) {
+		no.genesis = h.String()
+	}
+}
+
+// WithCodecs sets names of supported codecs in preference order.
+func WithCodecs(names ...string) NetworkOption {
+	return func(no *netOptions) {
+		for _, name := range names {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				no.codecNames = append(no.codecNames, name)
+			}
+		}
+	}
+}
@@ -3,9 +3,12 @@ package network
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"net"
+	"sync"
 
+	"github.com/igumus/chainx/core"
 	"github.com/rs/zerolog/log"
 )
 
@@ -33,11 +36,15 @@ type Peer interface {
 }
 
 type peer struct {
-	id       string
-	state    PeerState
 	peerType string
 	conn     net.Conn
 	incoming bool
+
+	// set by handshake, while the read loop is already running
+	lock  sync.RWMutex
+	id    string
+	state PeerState
+	codec core.Codec
 }
 
 func (p *peer) readLoop(delCh chan<- *peer, rpcCh chan<- RemoteMessage) {
@@ -49,7 +56,7 @@ func (p *peer) readLoop(delCh chan<- *peer, rpcCh chan<- RemoteMessage) {
 	for {
 		err := binary.Read(p.conn, binary.LittleEndian, &size)
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || errors.Is(err, net.ErrClosed) {
 				break
 			}
 			log.Error().Err(err).Str("type", p.Type()).Str("addr", p.Addr()).Msg("reading from peer failed")
@@ -58,7 +65,7 @@ func (p *peer) readLoop(delCh chan<- *peer, rpcCh chan<- RemoteMessage) {
 		buf = new(bytes.Buffer)
 		n, err := io.CopyN(buf, p.conn, size)
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || errors.Is(err, net.ErrClosed) {
 				break
 			}
 			log.Error().Err(err).Str("type", p.Type()).Str("addr", p.Addr()).Msg("copying from peer failed")
@@ -69,13 +76,16 @@ func (p *peer) readLoop(delCh chan<- *peer, rpcCh chan<- RemoteMessage) {
 			log.Debug().Str("type", p.Type()).Str("addr", p.Addr()).Int64("readBytes", n).Msg("incoming message accepted")
 		}
 
-		from := p.ID()
+		p.lock.RLock()
+		from, codec := PeerID(p.id), p.codec
 		if p.state == PendingPeer {
 			from = PeerID(p.Addr())
 		}
+		p.lock.RUnlock()
 
 		rpcCh <- RemoteMessage{
 			From:    from,
+			Codec:   codec,
 			Payload: buf.Bytes(),
 		}
 
@@ -83,10 +93,13 @@ func (p *peer) readLoop(delCh chan<- *peer, rpcCh chan<- RemoteMessage) {
 	delCh <- p
 }
 
-func (p *peer) handshake(id string) {
+func (p *peer) handshake(id string, codec core.Codec) {
+	p.lock.Lock()
 	p.id = id
+	p.codec = codec
 	p.state = HandshakedPeer
-	log.Info().Str("peer", p.id).Str("addr", p.conn.RemoteAddr().String()).Msg("changed peer state to handshaked")
+	p.lock.Unlock()
+	log.Info().Str("peer", id).Str("addr", p.conn.RemoteAddr().String()).Msg("changed peer state to handshaked")
 }
 
 func (p *peer) IsOutgoing() bool {
@@ -98,9 +111,18 @@ func (p *peer) Type() string {
 }
 
 func (p *peer) ID() PeerID {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 	return PeerID(p.id)
 }
 
+// messageCodec returns the codec negotiated in handshake.
+func (p *peer) messageCodec() core.Codec {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.codec
+}
+
 func (p *peer) Addr() string {
 	return p.conn.RemoteAddr().String()
 }
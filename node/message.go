@@ -1,7 +1,11 @@
 package node
 
 import (
+	"encoding/binary"
+	"errors"
+
 	"github.com/igumus/chainx/core"
+	"github.com/igumus/chainx/hash"
 	"github.com/igumus/chainx/network"
 )
 
@@ -20,3 +24,111 @@ type FetchBlockMessage struct {
 type FetchBlockReply struct {
 	Blocks []*core.Block
 }
+
+// TxRejectedMessage tells the sender of a transaction why it was not
+// accepted into the pool.
+type TxRejectedMessage struct {
+	TxHash hash.Hash
+	Reason string
+}
+
+var ErrMessageMalformed = errors.New("malformed node message")
+
+// MarshalCanonical encodes the message as:
+//
+//	id length u32 | id | from u32 | to u32
+func (m *FetchBlockMessage) MarshalCanonical() ([]byte, error) {
+	buf := make([]byte, 4, 12+len(m.ID))
+	binary.LittleEndian.PutUint32(buf, uint32(len(m.ID)))
+	buf = append(buf, m.ID...)
+	buf = binary.LittleEndian.AppendUint32(buf, m.From)
+	return binary.LittleEndian.AppendUint32(buf, m.To), nil
+}
+
+func (m *FetchBlockMessage) UnmarshalCanonical(b []byte) error {
+	if len(b) < 4 {
+		return ErrMessageMalformed
+	}
+	size := int(binary.LittleEndian.Uint32(b))
+	if len(b) != 12+size {
+		return ErrMessageMalformed
+	}
+	m.ID = network.PeerID(b[4 : 4+size])
+	m.From = binary.LittleEndian.Uint32(b[4+size:])
+	m.To = binary.LittleEndian.Uint32(b[8+size:])
+	return nil
+}
+
+// MarshalCanonical encodes the message as block count u32, followed by
+// length u32 and canonical encoding of every block.
+func (m *FetchBlockReply) MarshalCanonical() ([]byte, error) {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(m.Blocks)))
+	for _, b := range m.Blocks {
+		data := b.Bytes()
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+func (m *FetchBlockReply) UnmarshalCanonical(b []byte) error {
+	if len(b) < 4 {
+		return ErrMessageMalformed
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+
+	blocks := []*core.Block{}
+	for i := uint32(0); i < count; i++ {
+		if len(b) < 4 {
+			return ErrMessageMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(b))
+		if len(b) < 4+size {
+			return ErrMessageMalformed
+		}
+		block, err := core.BlockFromBytes(b[4 : 4+size])
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, block)
+		b = b[4+size:]
+	}
+	if len(b) != 0 {
+		return ErrMessageMalformed
+	}
+	m.Blocks = blocks
+	return nil
+}
+
+// MarshalCanonical encodes the message as:
+//
+//	hash length u32 | hash | reason length u32 | reason
+func (m *TxRejectedMessage) MarshalCanonical() ([]byte, error) {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(m.TxHash)))
+	buf = append(buf, m.TxHash...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.Reason)))
+	return append(buf, m.Reason...), nil
+}
+
+func (m *TxRejectedMessage) UnmarshalCanonical(b []byte) error {
+	if len(b) < 4 {
+		return ErrMessageMalformed
+	}
+	size := int(binary.LittleEndian.Uint32(b))
+	if len(b) < 8+size {
+		return ErrMessageMalformed
+	}
+	txHash, err := hash.FromBytes(b[4 : 4+size])
+	if err != nil {
+		return err
+	}
+	b = b[4+size:]
+	size = int(binary.LittleEndian.Uint32(b))
+	if len(b) != 4+size {
+		return ErrMessageMalformed
+	}
+	m.TxHash = txHash
+	m.Reason = string(b[4:])
+	return nil
+}
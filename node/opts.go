@@ -65,7 +65,7 @@ func createOptions(opts ...NodeOption) (*nodeOption, error) {
 	// instead of returning error, we will use
 	// default transaction pool implementation
 	if options.pool == nil {
-		p, err := core.NewTXPool()
+		p, err := core.NewTXPool(core.WithChainReader(options.chain))
 		if err != nil {
 			return nil, err
 		}
@@ -1,8 +1,7 @@
 package node
 
 import (
-	"bytes"
-	"encoding/gob"
+	"errors"
 	"time"
 
 	"github.com/igumus/chainx/core"
@@ -11,6 +10,10 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// number of blocks fetched at once below an orphan block to find the
+// common ancestor with the remote branch
+const forkFetchDepth = 16
+
 type Node interface {
 	Start()
 	network.RemoteMessageHandler
@@ -27,6 +30,7 @@ type node struct {
 	network   network.Network
 	logger    zerolog.Logger
 	messageCh <-chan network.RemoteMessage
+	reorgs    core.Subscription // lossless, a missed reorg would lose dropped txs
 	quitCh    chan struct{}
 }
 
@@ -47,6 +51,7 @@ func New(opts ...NodeOption) (Node, error) {
 		network:   options.network,
 		id:        network.PeerID(options.network.ID()),
 		messageCh: options.network.Consume(),
+		reorgs:    options.chain.SubscribeLossless(core.EventReorg),
 		quitCh:    make(chan struct{}, 1),
 	}
 
@@ -70,6 +75,8 @@ free:
 			if err := n.HandleMessage(msg); err != nil {
 				n.logger.Error().Err(err).Str("from", msg.From.String()).Msg("processing incoming message failed")
 			}
+		case event := <-n.reorgs.Events():
+			n.processReorg(event.(*core.Reorg))
 		case <-n.quitCh:
 			break free
 		}
@@ -87,7 +94,10 @@ func (n *node) createBlock() error {
 		return err
 	}
 
-	n.txpool.Flush()
+	// transactions left out of the block (e.g. exceeding block gas
+	// limit) stay in the pool for the next block
+	n.txpool.Remove(block.Transactions...)
+	n.txpool.Prune()
 
 	if err := n.broadcastBlock("", block); err != nil {
 		return err
@@ -96,13 +106,12 @@ func (n *node) createBlock() error {
 	return nil
 }
 
-func (n *node) fetchBlock(peer network.PeerID, remoteHeight uint32) error {
-	n.logger.Info().Str("peer", peer.String()).Uint32("ownHeight", n.chain.CurrentHeader().Height).Uint32("blockHeight", remoteHeight).Msg("fetching blocks")
+func (n *node) fetchBlock(peer network.PeerID, from uint32, remoteHeight uint32) error {
+	n.logger.Info().Str("peer", peer.String()).Uint32("ownHeight", n.chain.CurrentHeader().Height).Uint32("blockHeight", remoteHeight).Uint32("from", from).Msg("fetching blocks")
 
-	nextHeight := n.chain.CurrentHeader().Height + 1
-	request := FetchBlockMessage{
+	request := &FetchBlockMessage{
 		ID:   n.id,
-		From: nextHeight,
+		From: from,
 	}
 
 	if err := n.network.Send(peer, network.ChainFetchBlock, request); err != nil {
@@ -113,11 +122,40 @@ func (n *node) fetchBlock(peer network.PeerID, remoteHeight uint32) error {
 	return nil
 }
 
+// fetchAncestors fetches blocks of the peer below given block, whose
+// parent is unknown, to find the common ancestor with the peer's branch.
+// Blocks are fetched forkFetchDepth at a time; while the first fetched
+// block still has an unknown parent, fetching walks further back, down
+// to the side blocks retained by the chain.
+func (n *node) fetchAncestors(peer network.PeerID, block *core.Block) {
+	floor := uint32(1)
+	if head := n.chain.CurrentHeader().Height; head > core.SideBlockRetention {
+		floor = head - core.SideBlockRetention
+	}
+	if block.Header.Height <= floor {
+		n.logger.Warn().
+			Str("peer", peer.String()).
+			Uint32("height", block.Header.Height).
+			Msg("peer branch forks below retained side blocks")
+		return
+	}
+
+	from := floor
+	if block.Header.Height-floor > forkFetchDepth {
+		from = block.Header.Height - forkFetchDepth
+	}
+	go n.fetchBlock(peer, from, block.Header.Height)
+}
+
 func (n *node) processBlock(peer network.PeerID, block *core.Block) error {
 	n.logger.Info().Str("peer", peer.String()).Str("bHash", block.Header.Hash().String()).Msg("new block arrived")
 	if err := n.chain.AddBlock(block); err != nil {
 		if err == core.ErrBlockTooHigh {
-			go n.fetchBlock(peer, block.Header.Height)
+			go n.fetchBlock(peer, n.chain.CurrentHeader().Height+1, block.Header.Height)
+			return nil
+		}
+		if err == core.ErrBlockUnknownParent {
+			n.fetchAncestors(peer, block)
 			return nil
 		}
 		if err == core.ErrBlockKnown {
@@ -127,6 +165,8 @@ func (n *node) processBlock(peer network.PeerID, block *core.Block) error {
 		return err
 	}
 	n.logger.Info().Str("peer", peer.String()).Str("bHash", block.Header.Hash().String()).Msg("new block saved")
+	n.txpool.Remove(block.Transactions...)
+	n.txpool.Prune()
 
 	if err := n.broadcastBlock(peer, block); err != nil {
 		n.logger.Error().Err(err).Msg("broadcasting block failed")
@@ -136,18 +176,38 @@ func (n *node) processBlock(peer network.PeerID, block *core.Block) error {
 	return nil
 }
 
-func (n *node) broadcastBlock(from network.PeerID, block *core.Block) error {
-	buf := new(bytes.Buffer)
-	if err := core.EncodeBlock(buf, block); err != nil {
-		return err
+// processReorg returns transactions of dropped blocks, which are not
+// included by the new branch, back to the transaction pool.
+func (n *node) processReorg(reorg *core.Reorg) {
+	n.logger.Warn().
+		Str("ancestor", reorg.Ancestor.Hash().String()).
+		Str("newHead", reorg.NewHead.Hash().String()).
+		Int("dropped", len(reorg.Dropped)).
+		Int("added", len(reorg.Added)).
+		Msg("chain reorganized")
+
+	included := make(map[string]struct{})
+	for _, block := range reorg.Added {
+		for _, tx := range block.Transactions {
+			included[tx.Hash().String()] = struct{}{}
+		}
+		n.txpool.Remove(block.Transactions...)
 	}
 
-	message := &network.Message{
-		Header: network.ChainBlock,
-		Data:   buf.Bytes(),
+	for _, block := range reorg.Dropped {
+		for _, tx := range block.Transactions {
+			if _, ok := included[tx.Hash().String()]; ok {
+				continue
+			}
+			if err := n.txpool.Add(tx); err != nil {
+				n.logger.Error().Err(err).Str("txhash", tx.Hash().String()).Msg("returning dropped transaction to pool failed")
+			}
+		}
 	}
+}
 
-	if err := n.network.Broadcast(message, from); err != nil {
+func (n *node) broadcastBlock(from network.PeerID, block *core.Block) error {
+	if err := n.network.Broadcast(network.ChainBlock, block, from); err != nil {
 		n.logger.Error().Err(err).Msg("broadcasting block failed")
 		return err
 	}
@@ -156,6 +216,14 @@ func (n *node) broadcastBlock(from network.PeerID, block *core.Block) error {
 
 func (n *node) processTransaction(peer network.PeerID, tx *core.Transaction) error {
 	if err := n.txpool.Add(tx); err != nil {
+		if !isVerificationError(err) {
+			return err
+		}
+		// let the submitter know why transaction is dropped
+		reply := &TxRejectedMessage{TxHash: tx.Hash(), Reason: err.Error()}
+		if serr := n.network.Send(peer, network.ChainTxRejected, reply); serr != nil {
+			n.logger.Debug().Err(serr).Str("peer", peer.String()).Msg("sending transaction rejection to peer failed")
+		}
 		return err
 	}
 
@@ -164,18 +232,23 @@ func (n *node) processTransaction(peer network.PeerID, tx *core.Transaction) err
 	return nil
 }
 
-func (n *node) broadcastTransaction(from network.PeerID, tx *core.Transaction) error {
-	buf := new(bytes.Buffer)
-	if err := core.EncodeTransaction(buf, tx); err != nil {
-		return err
-	}
-
-	message := &network.Message{
-		Header: network.ChainTx,
-		Data:   buf.Bytes(),
-	}
+// isVerificationError reports whether transaction is rejected for itself
+// (signature, type, bytecode or chain id) rather than for the state of
+// the chain or pool. Honest peers run into the latter (e.g. nonce gaps,
+// echoes of included transactions) while gossiping, so those are not
+// replied to.
+func isVerificationError(err error) bool {
+	var bytecodeErr *core.BytecodeError
+	return errors.Is(err, crypto.ErrNoSignature) ||
+		errors.Is(err, crypto.ErrInvalidSignature) ||
+		errors.Is(err, crypto.ErrInvalidPublicKey) ||
+		errors.Is(err, core.ErrTxTypeNotValid) ||
+		errors.Is(err, core.ErrTxChainIDNotValid) ||
+		errors.As(err, &bytecodeErr)
+}
 
-	if err := n.network.Broadcast(message, from); err != nil {
+func (n *node) broadcastTransaction(from network.PeerID, tx *core.Transaction) error {
+	if err := n.network.Broadcast(network.ChainTx, tx, from); err != nil {
 		n.logger.Error().Err(err).Msg("broadcasting block failed")
 		return err
 	}
@@ -189,7 +262,7 @@ func (n *node) processBlockFetch(peer network.PeerID, payload *FetchBlockMessage
 		return err
 	}
 
-	if err := n.network.Send(peer, network.ChainFetchBlockReply, FetchBlockReply{Blocks: blocks}); err != nil {
+	if err := n.network.Send(peer, network.ChainFetchBlockReply, &FetchBlockReply{Blocks: blocks}); err != nil {
 		n.logger.Error().Err(err).Str("peer", peer.String()).Msg("sending reply message to peer failed")
 		return err
 	}
@@ -204,48 +277,62 @@ func (n *node) processSyncBlock(peer network.PeerID, payload *FetchBlockReply) e
 
 	for _, block := range payload.Blocks {
 		if err := n.chain.AddBlock(block); err != nil {
+			if err == core.ErrBlockKnown {
+				continue
+			}
+			if err == core.ErrBlockUnknownParent {
+				// fetched blocks start above the common ancestor
+				n.fetchAncestors(peer, block)
+				return nil
+			}
 			n.logger.Error().Err(err).Msg("sync block failed")
 			return err
 		}
+		n.txpool.Remove(block.Transactions...)
 	}
 
 	return nil
 }
 
 func (n *node) HandleMessage(msg network.RemoteMessage) error {
-	decodedMessage := &network.Message{}
-	if err := network.Decode(msg.Payload, decodedMessage); err != nil {
+	decodedMessage, err := msg.Decode()
+	if err != nil {
 		return err
 	}
 
 	peer := msg.From
-	payload := bytes.NewReader(decodedMessage.Data)
 
 	switch decodedMessage.Header {
 	case network.ChainTx:
 		data := &core.Transaction{}
-		if err := core.DecodeTransaction(payload, data); err != nil {
+		if err := msg.DecodeData(decodedMessage, data); err != nil {
 			return err
 		}
 		return n.processTransaction(peer, data)
 	case network.ChainBlock:
 		data := &core.Block{}
-		if err := core.DecodeBlock(payload, data); err != nil {
+		if err := msg.DecodeData(decodedMessage, data); err != nil {
 			return err
 		}
 		return n.processBlock(peer, data)
 	case network.ChainFetchBlock:
 		data := &FetchBlockMessage{}
-		if err := gob.NewDecoder(payload).Decode(data); err != nil {
+		if err := msg.DecodeData(decodedMessage, data); err != nil {
 			return err
 		}
 		return n.processBlockFetch(peer, data)
 	case network.ChainFetchBlockReply:
 		data := &FetchBlockReply{}
-		if err := gob.NewDecoder(payload).Decode(data); err != nil {
+		if err := msg.DecodeData(decodedMessage, data); err != nil {
 			return err
 		}
 		return n.processSyncBlock(peer, data)
+	case network.ChainTxRejected:
+		data := &TxRejectedMessage{}
+		if err := msg.DecodeData(decodedMessage, data); err != nil {
+			return err
+		}
+		n.logger.Warn().Str("peer", peer.String()).Str("txhash", data.TxHash.String()).Str("reason", data.Reason).Msg("transaction rejected by peer")
 	default:
 		n.logger.Error().Str("peer", peer.String()).Msg("unknown chain message header")
 	}
@@ -265,4 +352,5 @@ func (n *node) validatorLoop() {
 
 func (n *node) shutdown() {
 	n.logger.Info().Msg("shutdown process starting")
+	n.reorgs.Unsubscribe()
 }
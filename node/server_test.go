@@ -2,10 +2,14 @@ package node
 
 import (
 	"bytes"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/igumus/chainx/core"
+	"github.com/igumus/chainx/crypto"
 	"github.com/igumus/chainx/network"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,3 +35,152 @@ func TestMessageEncoding(t *testing.T) {
 	require.NotNil(t, encMsg)
 
 }
+
+func TestMessageCodecs(t *testing.T) {
+	block, err := core.GenesisBlock()
+	require.Nil(t, err)
+
+	for _, codec := range core.Codecs() {
+		t.Run(codec.Name(), func(t *testing.T) {
+			request := &FetchBlockMessage{ID: "peer", From: 1, To: 5}
+			message, err := network.NewMessage(network.ChainFetchBlock, request, codec)
+			require.Nil(t, err)
+
+			payload, err := message.Bytes()
+			require.Nil(t, err)
+			remote := network.RemoteMessage{From: "peer", Codec: codec, Payload: payload}
+
+			decodedMessage, err := remote.Decode()
+			require.Nil(t, err)
+			require.Equal(t, network.ChainFetchBlock, decodedMessage.Header)
+
+			decodedRequest := &FetchBlockMessage{}
+			require.Nil(t, remote.DecodeData(decodedMessage, decodedRequest))
+			require.Equal(t, request, decodedRequest)
+
+			reply := &FetchBlockReply{Blocks: []*core.Block{block}}
+			message, err = network.NewMessage(network.ChainFetchBlockReply, reply, codec)
+			require.Nil(t, err)
+
+			decodedReply := &FetchBlockReply{}
+			require.Nil(t, remote.DecodeData(message, decodedReply))
+			require.Len(t, decodedReply.Blocks, 1)
+			require.Equal(t, block.Header.Hash(), decodedReply.Blocks[0].Header.Hash())
+
+			rejected := &TxRejectedMessage{TxHash: block.Header.Hash(), Reason: "stack underflow"}
+			message, err = network.NewMessage(network.ChainTxRejected, rejected, codec)
+			require.Nil(t, err)
+
+			decodedRejected := &TxRejectedMessage{}
+			require.Nil(t, remote.DecodeData(message, decodedRejected))
+			require.Equal(t, rejected, decodedRejected)
+		})
+	}
+}
+
+// recordingNetwork records rejections and block fetches sent to peers
+// and drops every other message.
+type recordingNetwork struct {
+	network.Network
+	lock     sync.Mutex
+	rejected []*TxRejectedMessage
+	fetches  chan *FetchBlockMessage
+}
+
+func (n *recordingNetwork) Send(to network.PeerID, mtype network.MessageType, data any) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if mtype == network.ChainTxRejected {
+		n.rejected = append(n.rejected, data.(*TxRejectedMessage))
+	}
+	if mtype == network.ChainFetchBlock && n.fetches != nil {
+		n.fetches <- data.(*FetchBlockMessage)
+	}
+	return nil
+}
+
+func (n *recordingNetwork) Broadcast(network.MessageType, any, network.PeerID) error {
+	return nil
+}
+
+func TestProcessTransactionRejections(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+
+	bc, err := core.NewBlockChain()
+	require.Nil(t, err)
+	pool, err := core.NewTXPool(core.WithChainReader(bc))
+	require.Nil(t, err)
+	net := &recordingNetwork{}
+	n := &node{txpool: pool, chain: bc, network: net, logger: zerolog.Nop()}
+
+	signed := func(tx *core.Transaction) *core.Transaction {
+		require.Nil(t, tx.Sign(kp))
+		return tx
+	}
+
+	// accepted transactions, their echoes and nonce gaps are not replied
+	tx := signed(core.NewTransferTransaction(crypto.Address{}, 0, 0))
+	require.Nil(t, n.processTransaction("peer", tx))
+	require.Nil(t, n.processTransaction("peer", tx))
+	require.NotNil(t, n.processTransaction("peer", signed(core.NewTransferTransaction(crypto.Address{}, 0, 5))))
+	require.Empty(t, net.rejected)
+
+	// transactions failing verification are
+	unsigned := core.NewTransferTransaction(crypto.Address{}, 0, 1)
+	wrongChain := core.NewTransferTransaction(crypto.Address{}, 0, 1)
+	wrongChain.ChainID = 7
+	badCode := core.NewTransaction([]byte{byte(core.InstrAdd)})
+	badCode.Nonce = 1
+	for _, tx := range []*core.Transaction{unsigned, signed(wrongChain), signed(badCode)} {
+		require.NotNil(t, n.processTransaction("peer", tx))
+	}
+	require.Len(t, net.rejected, 3)
+}
+
+func TestProcessBlockDeepFork(t *testing.T) {
+	local, err := core.NewBlockChain()
+	require.Nil(t, err)
+	remote, err := core.NewBlockChain()
+	require.Nil(t, err)
+
+	// branches fork at genesis, deeper than a single fetch reaches
+	for _, c := range []struct {
+		chain  core.BlockChain
+		blocks int
+	}{{local, 2 * forkFetchDepth}, {remote, 3 * forkFetchDepth}} {
+		kp, err := crypto.GenerateKeyPair()
+		require.Nil(t, err)
+		for i := 0; i < c.blocks; i++ {
+			_, err := c.chain.CreateBlock(kp, nil)
+			require.Nil(t, err)
+		}
+	}
+
+	pool, err := core.NewTXPool(core.WithChainReader(local))
+	require.Nil(t, err)
+	net := &recordingNetwork{fetches: make(chan *FetchBlockMessage, 1)}
+	n := &node{txpool: pool, chain: local, network: net, logger: zerolog.Nop()}
+
+	head, err := remote.GetBlocks(remote.CurrentHeader().Height)
+	require.Nil(t, err)
+	require.Nil(t, n.processBlock("peer", head[0]))
+
+	// answer fetches until the node stops walking back
+	fetched := []uint32{}
+	for local.CurrentHeader().Height != remote.CurrentHeader().Height {
+		var request *FetchBlockMessage
+		select {
+		case request = <-net.fetches:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("node stopped fetching at height %d", local.CurrentHeader().Height)
+		}
+		fetched = append(fetched, request.From)
+		blocks, err := remote.GetBlocks(request.From)
+		require.Nil(t, err)
+		require.Nil(t, n.processSyncBlock("peer", &FetchBlockReply{Blocks: blocks}))
+	}
+	require.Equal(t, remote.CurrentHeader().Hash(), local.CurrentHeader().Hash())
+	require.Equal(t, uint32(1), fetched[len(fetched)-1])
+	require.Greater(t, len(fetched), 2)
+}